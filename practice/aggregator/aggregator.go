@@ -0,0 +1,141 @@
+// 任务聚合器
+
+// 设置了 Group 的任务入队后停留在分组中，聚合器定期检查各分组，
+// 满足条件时调用用户提供的函数把同组任务合并为一个任务放入就绪列表
+
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"practice/logging"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+)
+
+// AggregateFunc 把同组的任务合并为一个任务，tasks 按入组时间排序
+type AggregateFunc func(group string, tasks []*taskstruct.Task) (*taskstruct.Task, error)
+
+type Aggregator struct {
+	queue     *queue.Queue
+	aggregate AggregateFunc
+
+	gracePeriod time.Duration
+	maxDelay    time.Duration
+	maxSize     int
+	interval    time.Duration
+	logger      logging.Logger
+}
+
+// Option 聚合器的可选配置，在构造函数中传入
+type Option func(*Aggregator)
+
+// WithGracePeriod 分组在最近一个任务入组后多久没有新任务即聚合，默认1分钟，0表示不按静默期聚合
+func WithGracePeriod(gracePeriod time.Duration) Option {
+	return func(a *Aggregator) {
+		a.gracePeriod = gracePeriod
+	}
+}
+
+// WithMaxDelay 分组中最早的任务最多等待多久，0表示不限制
+func WithMaxDelay(maxDelay time.Duration) Option {
+	return func(a *Aggregator) {
+		a.maxDelay = maxDelay
+	}
+}
+
+// WithMaxSize 分组任务数达到 maxSize 时立即聚合，每次最多合并 maxSize 个，0表示不限制
+func WithMaxSize(maxSize int) Option {
+	return func(a *Aggregator) {
+		a.maxSize = maxSize
+	}
+}
+
+// WithInterval 检查分组的间隔，默认1秒
+func WithInterval(interval time.Duration) Option {
+	return func(a *Aggregator) {
+		if interval > 0 {
+			a.interval = interval
+		}
+	}
+}
+
+func WithLogger(logger logging.Logger) Option {
+	return func(a *Aggregator) {
+		a.logger = logger
+	}
+}
+
+// New 聚合 q 中的分组任务，合并后的任务放回 q 的就绪列表
+func New(q *queue.Queue, aggregate AggregateFunc, opts ...Option) *Aggregator {
+	a := &Aggregator{
+		queue:       q,
+		aggregate:   aggregate,
+		gracePeriod: time.Minute,
+		interval:    time.Second,
+		logger:      logging.Nop{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Run 每隔 interval 检查一次所有分组，直到 ctx 被取消
+func (a *Aggregator) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		if _, err := a.Aggregate(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Error("aggregate groups failed", "queue", a.queue.GetName(), "error", err)
+		}
+		timer.Reset(a.interval)
+	}
+}
+
+// Aggregate 检查所有分组，合并满足条件的分组，返回入队的合并任务数
+// 被合并的任务在合并任务入队的同时从分组中移除，合并失败时任务留在分组中等待下次聚合
+func (a *Aggregator) Aggregate(ctx context.Context) (int, error) {
+	groups, err := a.queue.Groups(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	enqueued := 0
+	for _, group := range groups {
+		tasks, err := a.queue.ReadyGroup(ctx, group, a.gracePeriod, a.maxDelay, a.maxSize)
+		if err != nil {
+			return enqueued, err
+		}
+		if len(tasks) == 0 {
+			continue
+		}
+		if err := a.enqueue(ctx, group, tasks); err != nil {
+			a.logger.Error("aggregate group failed", "queue", a.queue.GetName(), "group", group, "size", len(tasks), "error", err)
+			continue
+		}
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+func (a *Aggregator) enqueue(ctx context.Context, group string, tasks []*taskstruct.Task) error {
+	combined, err := a.aggregate(group, tasks)
+	if err != nil {
+		return fmt.Errorf("合并任务失败: %w", err)
+	}
+	if combined == nil {
+		return fmt.Errorf("合并任务失败: 分组 %s 的合并函数返回了空任务", group)
+	}
+	if err := a.queue.CommitGroup(ctx, group, tasks, combined); err != nil {
+		return err
+	}
+	a.logger.Debug("group aggregated", "queue", a.queue.GetName(), "group", group, "size", len(tasks), "task_id", combined.ID)
+	return nil
+}
@@ -0,0 +1,145 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+func enqueueGroup(t *testing.T, q *queue.Queue, group string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		task := taskstruct.NewTask("notify", map[string]interface{}{"index": i}, 3)
+		task.Group = group
+		if err := q.EnqueueTask(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAggregateMaxSize(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("notify", engine)
+	enqueueGroup(t, q, "user-1", 3)
+
+	a := New(q, func(group string, tasks []*taskstruct.Task) (*taskstruct.Task, error) {
+		return taskstruct.NewTask("notify_batch", map[string]interface{}{"group": group, "count": len(tasks)}, 3), nil
+	}, WithGracePeriod(0), WithMaxSize(3))
+	enqueued, err := a.Aggregate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enqueued != 1 {
+		t.Fatalf("enqueued = %d, want 1", enqueued)
+	}
+
+	combined, err := q.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if combined.Type != "notify_batch" || combined.Group != "" || combined.Payload["count"] != float64(3) {
+		t.Fatalf("combined = %+v, want a batch of 3 without group", combined)
+	}
+	size, err := engine.ZCard(ctx, queue.GroupKey("test", "notify", "user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Fatalf("group size = %d, want 0", size)
+	}
+	bodies, err := engine.HGetAll(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 0 {
+		t.Fatalf("task bodies = %v, want none left", bodies)
+	}
+}
+
+func TestAggregateNilResultKeepsGroup(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("notify", engine)
+	enqueueGroup(t, q, "user-1", 2)
+
+	a := New(q, func(group string, tasks []*taskstruct.Task) (*taskstruct.Task, error) {
+		return nil, nil
+	}, WithGracePeriod(0), WithMaxSize(2))
+	enqueued, err := a.Aggregate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enqueued != 0 {
+		t.Fatalf("enqueued = %d, want 0", enqueued)
+	}
+	size, err := engine.ZCard(ctx, queue.GroupKey("test", "notify", "user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 2 {
+		t.Fatalf("group size = %d, want the 2 tasks kept for the next round", size)
+	}
+}
+
+func TestCommitGroupChanged(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("notify", engine)
+	enqueueGroup(t, q, "user-1", 2)
+
+	tasks, err := q.ReadyGroup(ctx, "user-1", 0, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 另一个聚合器先合并了同一批任务
+	if err := q.CommitGroup(ctx, "user-1", tasks, taskstruct.NewTask("notify_batch", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	err = q.CommitGroup(ctx, "user-1", tasks, taskstruct.NewTask("notify_batch", nil, 3))
+	if !errors.Is(err, queue.ErrGroupChanged) {
+		t.Fatalf("second CommitGroup error = %v, want ErrGroupChanged", err)
+	}
+	pending, err := engine.LLen(ctx, queue.QueueKey(queue.KindQueue, "notify"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != 1 {
+		t.Fatalf("pending = %d, want only the first combined task", pending)
+	}
+}
+
+type enqueueRecorder struct {
+	enqueued map[string]int
+}
+
+func (r *enqueueRecorder) TaskEnqueued(queue, taskType string)                        { r.enqueued[taskType]++ }
+func (r *enqueueRecorder) TaskDequeued(queue, taskType string, latency time.Duration) {}
+func (r *enqueueRecorder) TaskProcessed(queue, taskType string)                       {}
+func (r *enqueueRecorder) TaskFailed(queue, taskType string)                          {}
+func (r *enqueueRecorder) TaskRetried(queue, taskType string)                         {}
+func (r *enqueueRecorder) TaskDeadLettered(queue, taskType string)                    {}
+
+// 分组任务在进入分组时计入入队数，合并后的任务不再重复计入
+func TestAggregateCountsEnqueuedOnce(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	recorder := &enqueueRecorder{enqueued: map[string]int{}}
+	q := queue.NewQueue("notify", engine, queue.WithRecorder(recorder))
+	enqueueGroup(t, q, "user-1", 3)
+
+	a := New(q, func(group string, tasks []*taskstruct.Task) (*taskstruct.Task, error) {
+		return taskstruct.NewTask("notify_batch", nil, 3), nil
+	}, WithGracePeriod(0), WithMaxSize(3))
+	if enqueued, err := a.Aggregate(ctx); err != nil || enqueued != 1 {
+		t.Fatalf("Aggregate = %d, %v, want 1", enqueued, err)
+	}
+	if recorder.enqueued["notify"] != 3 || recorder.enqueued["notify_batch"] != 0 {
+		t.Fatalf("enqueued = %v, want only the 3 grouped tasks", recorder.enqueued)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"practice/inspector"
+	"practice/queue"
+	"practice/scheduler"
+	"practice/taskstruct"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 解析命令自身的参数，并检查位置参数个数
+func parseArgs(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	rest := fs.Args()
+	if len(rest) < minArgs || len(rest) > maxArgs {
+		return nil, fmt.Errorf("参数个数错误")
+	}
+	return rest, nil
+}
+
+func runQueuesList(ctx context.Context, c *cli, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("queues ls", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	names, err := c.inspector.Queues(ctx)
+	if err != nil {
+		return err
+	}
+	statsList := []*inspector.QueueStats{}
+	for _, name := range names {
+		stats, err := c.inspector.GetQueueStats(ctx, name)
+		if err != nil {
+			return err
+		}
+		statsList = append(statsList, stats)
+	}
+	return c.print(statsList, func(t *table) {
+		t.header("QUEUE", "PENDING", "SCHEDULED", "RETRY", "DEAD", "PRIORITIZED", "DEADLINE")
+		for _, stats := range statsList {
+			t.row(stats.Queue, stats.Pending, stats.Scheduled, stats.Retry, stats.Dead, stats.Prioritized, stats.Deadline)
+		}
+	})
+}
+
+func runQueueStats(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("queue stats", flag.ContinueOnError)
+	days := fs.Int("days", 1, "显示最近几天的处理统计")
+	rest, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	stats, err := c.inspector.GetQueueStats(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	paused, err := c.inspector.IsPaused(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	history, err := c.inspector.History(ctx, rest[0], *days)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		*inspector.QueueStats
+		Paused  bool                    `json:"paused"`
+		History []*inspector.DailyStats `json:"history"`
+	}{stats, paused, history}
+	return c.print(result, func(t *table) {
+		t.row("Queue:", stats.Queue)
+		t.row("Paused:", paused)
+		t.row("Pending:", stats.Pending)
+		t.row("Scheduled:", stats.Scheduled)
+		t.row("Retry:", stats.Retry)
+		t.row("Dead:", stats.Dead)
+		t.row("Prioritized:", stats.Prioritized)
+		t.row("Deadline:", stats.Deadline)
+		t.row("Oldest pending:", stats.OldestPendingAge.Round(time.Second))
+		t.row("")
+		t.header("DATE", "PROCESSED", "FAILED")
+		for _, daily := range history {
+			t.row(daily.Date.Format("2006-01-02"), daily.Processed, daily.Failed)
+		}
+	})
+}
+
+func runTaskGet(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("task get", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	task, err := c.inspector.GetTask(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	return c.print(task, func(t *table) {
+		payload, _ := json.Marshal(task.Payload)
+		t.row("ID:", task.ID)
+		t.row("Type:", task.Type)
+		t.row("Status:", task.Status)
+		t.row("Retry:", fmt.Sprintf("%d/%d", task.Retry, task.MaxRetry))
+		t.row("Created:", task.Created.Format(time.RFC3339))
+		if task.Timeout > 0 {
+			t.row("Timeout:", task.Timeout)
+		}
+		t.row("Payload:", string(payload))
+	})
+}
+
+func runTaskCancel(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("task cancel", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	ok, err := c.inspector.CancelTask(ctx, rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("队列 %s 中没有待执行的任务 %s", rest[0], rest[1])
+	}
+	return c.message("任务 %s 已取消", rest[1])
+}
+
+func runDeadList(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("dlq ls", flag.ContinueOnError)
+	cursor := fs.Int64("cursor", 0, "分页起始位置")
+	count := fs.Int64("count", 20, "每页数量")
+	rest, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	infos, next, err := c.inspector.ListTasks(ctx, rest[0], inspector.TaskStateDead, *cursor, *count)
+	if err != nil {
+		return err
+	}
+
+	result := struct {
+		Tasks      []*inspector.TaskInfo `json:"tasks"`
+		NextCursor int64                 `json:"next_cursor"`
+	}{infos, next}
+	return c.print(result, func(t *table) {
+		t.header("ID", "TYPE", "RETRY", "CREATED")
+		for _, info := range infos {
+			if info.Task == nil {
+				t.row(info.ID, "-", "-", "-")
+				continue
+			}
+			t.row(info.ID, info.Task.Type, info.Task.Retry, info.Task.Created.Format(time.RFC3339))
+		}
+		if next != 0 {
+			t.row("")
+			t.row(fmt.Sprintf("下一页: -cursor %d", next))
+		}
+	})
+}
+
+func runDeadRequeue(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("dlq requeue", flag.ContinueOnError)
+	all := fs.Bool("all", false, "重新入队全部死信任务")
+	rest, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	if *all {
+		if len(rest) != 1 {
+			return fmt.Errorf("-all 不能同时指定任务ID")
+		}
+		moved, err := c.inspector.RequeueAllDeadTasks(ctx, rest[0])
+		if err != nil {
+			return err
+		}
+		return c.message("%d 个任务已重新入队", moved)
+	}
+
+	if len(rest) != 2 {
+		return fmt.Errorf("需要指定任务ID或 -all")
+	}
+	ok, err := c.inspector.RequeueDeadTask(ctx, rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("队列 %s 中没有死信任务 %s", rest[0], rest[1])
+	}
+	return c.message("任务 %s 已重新入队", rest[1])
+}
+
+func runEnqueue(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("enqueue", flag.ContinueOnError)
+	queueName := fs.String("queue", "", "队列名称")
+	taskType := fs.String("type", "", "任务类型")
+	payloadJSON := fs.String("payload", "{}", "JSON 格式的任务负载")
+	maxRetry := fs.Int("max-retry", 3, "最大重试次数")
+	delay := fs.Duration("delay", 0, "延迟执行时间，大于0时进入延迟队列")
+	timeout := fs.Duration("timeout", 0, "单次处理的超时时间，0表示使用 worker 的默认值")
+	group := fs.String("group", "", "聚合分组，非空时等待与同组任务合并")
+	priority := fs.Int("priority", 0, "优先级，指定时进入优先级队列")
+	deadline := fs.Duration("deadline", 0, "距现在的截止时间，大于0时按截止时间排序")
+	tenant := fs.String("tenant", "", "租户，非空时放入租户子队列")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *queueName == "" || *taskType == "" {
+		return fmt.Errorf("-queue 和 -type 不能为空")
+	}
+
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(*payloadJSON), &payload); err != nil {
+		return fmt.Errorf("解析负载失败: %w", err)
+	}
+
+	task := taskstruct.NewTask(*taskType, payload, *maxRetry)
+	task.Timeout = *timeout
+	task.Group = *group
+	task.Tenant = *tenant
+	if *deadline > 0 {
+		task.Deadline = time.Now().Add(*deadline)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	prioritized := set["priority"]
+	// 优先级队列不保留分组、租户和截止时间的路由，延迟队列不保留分组，组合使用时报错而不是静默忽略
+	// 延迟任务到期后按租户和截止时间放回普通队列
+	if prioritized {
+		if err := conflictingFlags(set, "priority", "delay", "group", "tenant", "deadline"); err != nil {
+			return err
+		}
+	}
+	if *delay > 0 {
+		if err := conflictingFlags(set, "delay", "group"); err != nil {
+			return err
+		}
+	}
+	task.Priority = *priority
+
+	if prioritized {
+		err := queue.NewPriorityQueue(*queueName, c.redisEngine).EnqueueTask(ctx, task)
+		if err != nil {
+			return err
+		}
+	} else if *delay > 0 {
+		err := queue.NewDelayQueue(*queueName, c.redisEngine, *delay).EnqueueTask(ctx, task)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := queue.NewQueue(*queueName, c.redisEngine).EnqueueTask(ctx, task)
+		if err != nil {
+			return err
+		}
+	}
+	return c.print(task, func(t *table) {
+		t.row("任务已入队:", task.ID)
+	})
+}
+
+// conflictingFlags name 与 others 中任意一个同时指定时返回错误
+func conflictingFlags(set map[string]bool, name string, others ...string) error {
+	for _, other := range others {
+		if set[other] {
+			return fmt.Errorf("-%s 不能与 -%s 同时使用", name, other)
+		}
+	}
+	return nil
+}
+
+func runPause(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("pause", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.inspector.PauseQueue(ctx, rest[0]); err != nil {
+		return err
+	}
+	return c.message("队列 %s 已暂停", rest[0])
+}
+
+func runResume(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("resume", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.inspector.ResumeQueue(ctx, rest[0]); err != nil {
+		return err
+	}
+	return c.message("队列 %s 已恢复", rest[0])
+}
+
+func runWorkersList(ctx context.Context, c *cli, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("workers ls", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	workers, err := c.inspector.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(workers, func(t *table) {
+		t.header("ID", "HOST", "PID", "QUEUES", "CONCURRENCY", "ACTIVE", "VERSION", "STARTED")
+		for _, info := range workers {
+			t.row(info.ID, info.Host, info.PID, strings.Join(info.Queues, ","), info.Concurrency, len(info.ActiveTasks), info.Version, info.StartedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+func runActiveList(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("active ls", flag.ContinueOnError)
+	lost := fs.Bool("lost", false, "只列出所属 worker 已消失的任务")
+	if _, err := parseArgs(fs, args, 0, 0); err != nil {
+		return err
+	}
+	list := c.inspector.ActiveTasks
+	if *lost {
+		list = c.inspector.LostTasks
+	}
+	infos, err := list(ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(infos, func(t *table) {
+		t.header("ID", "TYPE", "QUEUE", "WORKER", "STARTED", "LOST")
+		for _, info := range infos {
+			t.row(info.Task.ID, info.Task.Type, info.Queue, info.WorkerID, info.StartedAt.Format(time.RFC3339), info.Lost)
+		}
+	})
+}
+
+func runActiveRequeueLost(ctx context.Context, c *cli, args []string) error {
+	if _, err := parseArgs(flag.NewFlagSet("active requeue-lost", flag.ContinueOnError), args, 0, 0); err != nil {
+		return err
+	}
+	count, err := c.inspector.RequeueLostTasks(ctx)
+	if err != nil {
+		return err
+	}
+	return c.message("已放回 %d 个任务", count)
+}
+
+func runSchedulerList(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("scheduler ls", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	queues, err := c.inspector.GetSchedulerQueues(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	return c.print(queues, func(t *table) {
+		t.header("QUEUE", "PRIORITY", "CURRENT WEIGHT")
+		for _, q := range queues {
+			t.row(q.Queue, q.Priority, q.CurrentWeight)
+		}
+	})
+}
+
+func runSchedulerSet(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("scheduler set", flag.ContinueOnError), args, 3, 3)
+	if err != nil {
+		return err
+	}
+	priority, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return fmt.Errorf("无效优先级 %s", rest[2])
+	}
+	if err := scheduler.UpdateQueueConfig(ctx, c.redisEngine, rest[0], rest[1], priority); err != nil {
+		return err
+	}
+	return c.message("调度器 %s 队列 %s 的优先级已设为 %d", rest[0], rest[1], priority)
+}
+
+func runSchedulerRemove(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("scheduler rm", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	ok, err := scheduler.RemoveQueueConfig(ctx, c.redisEngine, rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("调度器 %s 中没有队列 %s", rest[0], rest[1])
+	}
+	return c.message("队列 %s 已从调度器 %s 移除", rest[1], rest[0])
+}
+
+func runTenantsList(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("tenants ls", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	tenants, err := c.inspector.Tenants(ctx, rest[0])
+	if err != nil {
+		return err
+	}
+	return c.print(tenants, func(t *table) {
+		t.header("TENANT", "PENDING", "WEIGHT")
+		for _, tenant := range tenants {
+			name := tenant.Tenant
+			if name == "" {
+				name = "-"
+			}
+			t.row(name, tenant.Pending, tenant.Weight)
+		}
+	})
+}
+
+func runTenantWeight(ctx context.Context, c *cli, args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("tenant weight", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	weight, err := strconv.Atoi(rest[1])
+	if err != nil {
+		return fmt.Errorf("无效权重 %s", rest[1])
+	}
+	if err := queue.SetTenantWeight(ctx, c.redisEngine, rest[0], weight); err != nil {
+		return err
+	}
+	if weight <= 0 {
+		return c.message("租户 %s 的权重已恢复默认值1", rest[0])
+	}
+	return c.message("租户 %s 的权重已设为 %d", rest[0], weight)
+}
@@ -0,0 +1,152 @@
+// redistrain 队列管理命令行工具
+
+// 用法: redistrain [连接参数] <命令> [命令参数]
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"practice/inspector"
+	"practice/redisengine"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type options struct {
+	addr      string
+	password  string
+	db        int
+	namespace string
+	output    string
+}
+
+// cli 每个命令运行时共享的连接和输出配置
+type cli struct {
+	options     *options
+	redisEngine *redisengine.RedisEngine
+	inspector   *inspector.Inspector
+	stdout      io.Writer
+}
+
+type command struct {
+	path    []string
+	usage   string
+	summary string
+	run     func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []*command{
+	{path: []string{"queues", "ls"}, usage: "queues ls", summary: "列出所有队列及其任务数", run: runQueuesList},
+	{path: []string{"queue", "stats"}, usage: "queue stats [-days n] <queue>", summary: "查看队列统计", run: runQueueStats},
+	{path: []string{"task", "get"}, usage: "task get <id>", summary: "查看任务详情", run: runTaskGet},
+	{path: []string{"task", "cancel"}, usage: "task cancel <queue> <id>", summary: "取消未执行的任务", run: runTaskCancel},
+	{path: []string{"dlq", "ls"}, usage: "dlq ls [-cursor n] [-count n] <queue>", summary: "列出死信任务", run: runDeadList},
+	{path: []string{"dlq", "requeue"}, usage: "dlq requeue [-all] <queue> [id]", summary: "死信任务重新入队", run: runDeadRequeue},
+	{path: []string{"enqueue"}, usage: "enqueue -queue q -type t [-payload json] [-max-retry n] [-delay d] [-timeout d] [-group g] [-priority n] [-deadline d] [-tenant t]", summary: "创建任务并入队", run: runEnqueue},
+	{path: []string{"workers", "ls"}, usage: "workers ls", summary: "列出存活的 worker", run: runWorkersList},
+	{path: []string{"active", "ls"}, usage: "active ls [-lost]", summary: "列出正在处理的任务", run: runActiveList},
+	{path: []string{"active", "requeue-lost"}, usage: "active requeue-lost", summary: "把所属 worker 已消失的任务放回原队列", run: runActiveRequeueLost},
+	{path: []string{"scheduler", "ls"}, usage: "scheduler ls <scheduler>", summary: "查看调度器的队列配置", run: runSchedulerList},
+	{path: []string{"scheduler", "set"}, usage: "scheduler set <scheduler> <queue> <priority>", summary: "添加队列或修改优先级/权重", run: runSchedulerSet},
+	{path: []string{"scheduler", "rm"}, usage: "scheduler rm <scheduler> <queue>", summary: "从调度器移除队列", run: runSchedulerRemove},
+	{path: []string{"tenants", "ls"}, usage: "tenants ls <queue>", summary: "列出队列中有任务的租户", run: runTenantsList},
+	{path: []string{"tenant", "weight"}, usage: "tenant weight <tenant> <weight>", summary: "设置租户权重，不大于0时恢复默认值1", run: runTenantWeight},
+	{path: []string{"pause"}, usage: "pause <queue>", summary: "暂停队列", run: runPause},
+	{path: []string{"resume"}, usage: "resume <queue>", summary: "恢复队列", run: runResume},
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run 执行命令并返回退出码，由 main 统一退出，保证 defer 的清理都已执行
+func run() int {
+	opts := &options{}
+	fs := flag.NewFlagSet("redistrain", flag.ExitOnError)
+	fs.StringVar(&opts.addr, "addr", "localhost:6379", "Redis 地址")
+	fs.StringVar(&opts.password, "password", "", "Redis 密码")
+	fs.IntVar(&opts.db, "db", 0, "Redis 数据库编号")
+	fs.StringVar(&opts.namespace, "namespace", "default", "命名空间，即 RedisEngine 名称")
+	fs.StringVar(&opts.output, "output", "table", "输出格式: table 或 json")
+	fs.Usage = func() { usage(fs) }
+	fs.Parse(os.Args[1:])
+
+	if opts.output != "table" && opts.output != "json" {
+		fmt.Fprintf(os.Stderr, "无效输出格式 %s\n", opts.output)
+		return 2
+	}
+
+	cmd, args := findCommand(fs.Args())
+	if cmd == nil {
+		usage(fs)
+		return 2
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     opts.addr,
+		Password: opts.password,
+		DB:       opts.db,
+	})
+	defer client.Close()
+
+	redisEngine := redisengine.NewRedisEngine(client, opts.namespace)
+	c := &cli{
+		options:     opts,
+		redisEngine: redisEngine,
+		inspector:   inspector.NewInspector(redisEngine),
+		stdout:      os.Stdout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd.run(ctx, c, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", strings.Join(cmd.path, " "), err)
+		return 1
+	}
+	return 0
+}
+
+// 按最长前缀匹配命令，返回剩余参数
+func findCommand(args []string) (*command, []string) {
+	var found *command
+	for _, cmd := range commands {
+		if len(args) < len(cmd.path) {
+			continue
+		}
+		matched := true
+		for idx, part := range cmd.path {
+			if args[idx] != part {
+				matched = false
+				break
+			}
+		}
+		if matched && (found == nil || len(cmd.path) > len(found.path)) {
+			found = cmd
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found, args[len(found.path):]
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "用法: redistrain [连接参数] <命令> [命令参数]")
+	fmt.Fprintln(out, "\n命令:")
+	w := tabwriter.NewWriter(out, 0, 4, 3, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\n连接参数:")
+	fs.PrintDefaults()
+}
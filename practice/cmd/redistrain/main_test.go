@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"practice/inspector"
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// newTestCLI 返回连接 miniredis 的 cli，输出写入返回的缓冲区
+func newTestCLI(t *testing.T, output string) (*cli, *bytes.Buffer) {
+	t.Helper()
+	_, engine := testredis.New(t)
+	out := &bytes.Buffer{}
+	return &cli{
+		options:     &options{namespace: testredis.Namespace, output: output},
+		redisEngine: engine,
+		inspector:   inspector.NewInspector(engine),
+		stdout:      out,
+	}, out
+}
+
+func TestFindCommandLongestPrefix(t *testing.T) {
+	cases := []struct {
+		args []string
+		path string
+		rest []string
+	}{
+		{[]string{"pause", "emails"}, "pause", []string{"emails"}},
+		{[]string{"queue", "stats", "-days", "3", "emails"}, "queue stats", []string{"-days", "3", "emails"}},
+		{[]string{"active", "requeue-lost"}, "active requeue-lost", []string{}},
+		{[]string{"dlq", "requeue", "-all", "emails"}, "dlq requeue", []string{"-all", "emails"}},
+	}
+	for _, tc := range cases {
+		cmd, rest := findCommand(tc.args)
+		if cmd == nil {
+			t.Fatalf("%v: no command found", tc.args)
+		}
+		if got := strings.Join(cmd.path, " "); got != tc.path {
+			t.Fatalf("%v: command = %q, want %q", tc.args, got, tc.path)
+		}
+		if strings.Join(rest, " ") != strings.Join(tc.rest, " ") {
+			t.Fatalf("%v: rest = %v, want %v", tc.args, rest, tc.rest)
+		}
+	}
+}
+
+func TestFindCommandUnknown(t *testing.T) {
+	for _, args := range [][]string{nil, {"queue"}, {"task"}, {"queues", "rm"}, {"stats", "queue"}} {
+		if cmd, _ := findCommand(args); cmd != nil {
+			t.Fatalf("%v: found %q, want none", args, strings.Join(cmd.path, " "))
+		}
+	}
+}
+
+// 命令路径不能重复，否则后一个永远匹配不到
+func TestCommandPathsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, cmd := range commands {
+		path := strings.Join(cmd.path, " ")
+		if seen[path] {
+			t.Fatalf("duplicate command %q", path)
+		}
+		seen[path] = true
+		if !strings.HasPrefix(cmd.usage, path) {
+			t.Fatalf("usage %q does not start with %q", cmd.usage, path)
+		}
+	}
+}
+
+func TestParseArgsCounts(t *testing.T) {
+	cases := []struct {
+		args     []string
+		min, max int
+		ok       bool
+	}{
+		{[]string{}, 0, 0, true},
+		{[]string{"emails"}, 0, 0, false},
+		{[]string{"emails"}, 1, 2, true},
+		{[]string{"emails", "id"}, 1, 2, true},
+		{[]string{}, 1, 2, false},
+		{[]string{"emails", "id", "extra"}, 1, 2, false},
+		{[]string{"-count", "5", "emails"}, 1, 1, true},
+		{[]string{"-unknown", "emails"}, 1, 1, false},
+	}
+	for _, tc := range cases {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Int("count", 0, "")
+		_, err := parseArgs(fs, tc.args, tc.min, tc.max)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%v [%d,%d]: err = %v, want ok = %v", tc.args, tc.min, tc.max, err, tc.ok)
+		}
+	}
+}
+
+func TestCommandsRejectWrongArgs(t *testing.T) {
+	c, _ := newTestCLI(t, "table")
+	cases := [][]string{
+		{"pause"},
+		{"task", "cancel", "emails"},
+		{"scheduler", "set", "main", "emails", "high"},
+		{"tenant", "weight", "acme", "x"},
+		{"dlq", "requeue", "emails"},
+		{"dlq", "requeue", "-all", "emails", "id"},
+		{"enqueue", "-queue", "emails"},
+		{"enqueue", "-queue", "emails", "-type", "send", "-priority", "1", "-tenant", "acme"},
+		{"enqueue", "-queue", "emails", "-type", "send", "-delay", "1m", "-group", "g"},
+	}
+	for _, args := range cases {
+		cmd, rest := findCommand(args)
+		if cmd == nil {
+			t.Fatalf("%v: no command found", args)
+		}
+		if err := cmd.run(context.Background(), c, rest); err == nil {
+			t.Fatalf("%v: expected error", args)
+		}
+	}
+}
+
+func TestQueuesListTable(t *testing.T) {
+	c, out := newTestCLI(t, "table")
+	q := queue.NewQueue("emails", c.redisEngine)
+	for i := 0; i < 2; i++ {
+		if err := q.EnqueueTask(context.Background(), taskstruct.NewTask("send", nil, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := runQueuesList(context.Background(), c, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q, want header and one row", out.String())
+	}
+	header, row := strings.Fields(lines[0]), strings.Fields(lines[1])
+	if header[0] != "QUEUE" || len(header) != len(row) {
+		t.Fatalf("header = %v, row = %v", header, row)
+	}
+	if row[0] != "emails" || row[1] != "2" {
+		t.Fatalf("row = %v, want emails with 2 pending", row)
+	}
+	// tabwriter 对齐后各列起始位置一致
+	if strings.Index(lines[0], "PENDING") != strings.Index(lines[1], "2") {
+		t.Fatalf("columns are not aligned:\n%s", out.String())
+	}
+}
+
+func TestQueuesListJSON(t *testing.T) {
+	c, out := newTestCLI(t, "json")
+	if err := queue.NewQueue("emails", c.redisEngine).EnqueueTask(context.Background(), taskstruct.NewTask("send", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := runQueuesList(context.Background(), c, nil); err != nil {
+		t.Fatal(err)
+	}
+	var statsList []*inspector.QueueStats
+	if err := json.Unmarshal(out.Bytes(), &statsList); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if len(statsList) != 1 || statsList[0].Queue != "emails" || statsList[0].Pending != 1 {
+		t.Fatalf("stats = %+v", statsList)
+	}
+}
+
+func TestMessageOutput(t *testing.T) {
+	c, out := newTestCLI(t, "table")
+	if err := c.message("队列 %s 已暂停", "emails"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "队列 emails 已暂停\n" {
+		t.Fatalf("table output = %q", out.String())
+	}
+
+	c.options.output = "json"
+	out.Reset()
+	if err := c.message("队列 %s 已恢复", "emails"); err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]string{}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["message"] != "队列 emails 已恢复" {
+		t.Fatalf("json output = %q", out.String())
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type table struct {
+	w io.Writer
+}
+
+func (t *table) header(columns ...string) {
+	fmt.Fprintln(t.w, strings.Join(columns, "\t"))
+}
+
+func (t *table) row(values ...interface{}) {
+	cells := make([]string, 0, len(values))
+	for _, value := range values {
+		cells = append(cells, fmt.Sprint(value))
+	}
+	fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+}
+
+// print 按 -output 输出结果，json 格式直接序列化 v，table 格式交给 render 渲染
+func (c *cli) print(v interface{}, render func(t *table)) error {
+	if c.options.output == "json" {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	render(&table{w: w})
+	return w.Flush()
+}
+
+// message 输出一条操作结果
+func (c *cli) message(format string, args ...interface{}) error {
+	text := fmt.Sprintf(format, args...)
+	return c.print(map[string]string{"message": text}, func(t *table) {
+		t.row(text)
+	})
+}
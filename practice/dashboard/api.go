@@ -0,0 +1,213 @@
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"practice/inspector"
+	"practice/queue"
+	"strconv"
+)
+
+type queueDetail struct {
+	*inspector.QueueStats
+	Paused  bool                    `json:"paused"`
+	History []*inspector.DailyStats `json:"history"`
+}
+
+const historyDays = 7
+
+func (h *Handler) getQueueDetail(r *http.Request, name string) (*queueDetail, error) {
+	ctx := r.Context()
+	stats, err := h.inspector.GetQueueStats(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	paused, err := h.inspector.IsPaused(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	history, err := h.inspector.History(ctx, name, historyDays)
+	if err != nil {
+		return nil, err
+	}
+	return &queueDetail{QueueStats: stats, Paused: paused, History: history}, nil
+}
+
+func (h *Handler) listQueueDetails(r *http.Request) ([]*queueDetail, error) {
+	names, err := h.inspector.Queues(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	details := []*queueDetail{}
+	for _, name := range names {
+		detail, err := h.getQueueDetail(r, name)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, detail)
+	}
+	return details, nil
+}
+
+// 从查询参数解析任务状态和分页参数
+func parseListQuery(r *http.Request) (inspector.TaskState, int64, int64, error) {
+	query := r.URL.Query()
+	state := inspector.TaskState(query.Get("state"))
+	if state == "" {
+		state = inspector.TaskStatePending
+	}
+	cursor, count := int64(0), int64(20)
+	var err error
+	if value := query.Get("cursor"); value != "" {
+		if cursor, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return "", 0, 0, fmt.Errorf("无效 cursor %s", value)
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		if count, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return "", 0, 0, fmt.Errorf("无效 count %s", value)
+		}
+	}
+	return state, cursor, count, nil
+}
+
+func (h *Handler) apiListQueues(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	details, err := h.listQueueDetails(r)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+func (h *Handler) apiGetQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	detail, err := h.getQueueDetail(r, params["queue"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (h *Handler) apiPauseQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := h.inspector.PauseQueue(r.Context(), params["queue"]); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiResumeQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := h.inspector.ResumeQueue(r.Context(), params["queue"]); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiListTasks(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	state, cursor, count, err := parseListQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	infos, next, err := h.inspector.ListTasks(r.Context(), params["queue"], state, cursor, count)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tasks":       infos,
+		"next_cursor": next,
+	})
+}
+
+func (h *Handler) apiCancelTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.apiTaskAction(w, r, params, h.inspector.CancelTask)
+}
+
+func (h *Handler) apiRequeueDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.apiTaskAction(w, r, params, h.inspector.RequeueDeadTask)
+}
+
+func (h *Handler) apiDeleteDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.apiTaskAction(w, r, params, h.inspector.DeleteDeadTask)
+}
+
+// 对单个任务执行操作，任务不存在时返回404
+func (h *Handler) apiTaskAction(w http.ResponseWriter, r *http.Request, params map[string]string, action taskAction) {
+	ok, err := action(r.Context(), params["queue"], params["id"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("队列 %s 中没有任务 %s", params["queue"], params["id"]))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) apiRequeueAllDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	moved, err := h.inspector.RequeueAllDeadTasks(r.Context(), params["queue"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"requeued": moved})
+}
+
+func (h *Handler) apiGetTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	task, err := h.inspector.GetTask(r.Context(), params["id"])
+	if err != nil {
+		if errors.Is(err, queue.ErrTaskNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, task)
+}
+
+func (h *Handler) apiGetScheduler(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	queues, err := h.inspector.GetSchedulerQueues(r.Context(), params["scheduler"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, queues)
+}
+
+func (h *Handler) apiListWorkers(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	workers, err := h.inspector.Workers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, workers)
+}
+
+// 查询参数 lost=true 时只返回所属 worker 已消失的任务
+func (h *Handler) apiListActiveTasks(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	list := h.inspector.ActiveTasks
+	if r.URL.Query().Get("lost") == "true" {
+		list = h.inspector.LostTasks
+	}
+	infos, err := list(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (h *Handler) apiRequeueLostTasks(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	requeued, err := h.inspector.RequeueLostTasks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"requeued": requeued})
+}
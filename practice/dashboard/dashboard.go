@@ -0,0 +1,212 @@
+// 管理后台
+
+// 提供队列、任务、死信和调度器权重的JSON接口，以及一个服务端渲染的HTML页面
+
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"practice/inspector"
+	"practice/redisengine"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+type route struct {
+	method  string
+	pattern []string // 以 : 开头的段为路径参数
+	handle  func(w http.ResponseWriter, r *http.Request, params map[string]string)
+}
+
+type Handler struct {
+	pathPrefix string
+	inspector  *inspector.Inspector
+	templates  *template.Template
+	static     http.Handler
+	routes     []*route
+}
+
+// New 创建管理后台，pathPrefix 为挂载路径，例如 "/admin"，挂载在根路径时传空串
+func New(redisEngine *redisengine.RedisEngine, pathPrefix string) *Handler {
+	h := &Handler{
+		pathPrefix: strings.TrimSuffix(pathPrefix, "/"),
+		inspector:  inspector.NewInspector(redisEngine),
+	}
+
+	h.templates = template.Must(template.New("").Funcs(template.FuncMap{
+		"path":     h.path,
+		"duration": formatDuration,
+		"bar":      barPercent,
+	}).ParseFS(templateFS, "templates/*.html"))
+
+	staticRoot, _ := fs.Sub(staticFS, "static")
+	h.static = http.StripPrefix(h.pathPrefix+"/static/", http.FileServer(http.FS(staticRoot)))
+
+	h.routes = []*route{
+		// JSON接口
+		{http.MethodGet, split("api/queues"), h.apiListQueues},
+		{http.MethodGet, split("api/queues/:queue"), h.apiGetQueue},
+		{http.MethodPost, split("api/queues/:queue/pause"), h.apiPauseQueue},
+		{http.MethodPost, split("api/queues/:queue/resume"), h.apiResumeQueue},
+		{http.MethodGet, split("api/queues/:queue/tasks"), h.apiListTasks},
+		{http.MethodDelete, split("api/queues/:queue/tasks/:id"), h.apiCancelTask},
+		{http.MethodPost, split("api/queues/:queue/dead/requeue"), h.apiRequeueAllDead},
+		{http.MethodPost, split("api/queues/:queue/dead/:id/requeue"), h.apiRequeueDead},
+		{http.MethodDelete, split("api/queues/:queue/dead/:id"), h.apiDeleteDead},
+		{http.MethodGet, split("api/tasks/:id"), h.apiGetTask},
+		{http.MethodGet, split("api/schedulers/:scheduler"), h.apiGetScheduler},
+		{http.MethodGet, split("api/workers"), h.apiListWorkers},
+		{http.MethodGet, split("api/active"), h.apiListActiveTasks},
+		{http.MethodPost, split("api/active/requeue-lost"), h.apiRequeueLostTasks},
+
+		// 页面
+		{http.MethodGet, nil, h.pageIndex},
+		{http.MethodGet, split("queues/:queue"), h.pageQueue},
+		{http.MethodPost, split("queues/:queue/pause"), h.actionPauseQueue},
+		{http.MethodPost, split("queues/:queue/resume"), h.actionResumeQueue},
+		{http.MethodPost, split("queues/:queue/tasks/:id/cancel"), h.actionCancelTask},
+		{http.MethodPost, split("queues/:queue/dead/requeue"), h.actionRequeueAllDead},
+		{http.MethodPost, split("queues/:queue/dead/:id/requeue"), h.actionRequeueDead},
+		{http.MethodPost, split("queues/:queue/dead/:id/delete"), h.actionDeleteDead},
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), h.pathPrefix)
+	if strings.HasPrefix(escaped, "/static/") {
+		h.static.ServeHTTP(w, r)
+		return
+	}
+
+	segments := []string{}
+	for _, segment := range split(escaped) {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		segments = append(segments, unescaped)
+	}
+
+	methodAllowed := true
+	for _, rt := range h.routes {
+		params, ok := match(rt.pattern, segments)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			methodAllowed = false
+			continue
+		}
+		if rt.method != http.MethodGet && !sameOrigin(r) {
+			http.Error(w, "跨站请求被拒绝", http.StatusForbidden)
+			return
+		}
+		rt.handle(w, r, params)
+		return
+	}
+	if !methodAllowed {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// sameOrigin 修改状态的请求必须来自本站页面，防止跨站请求伪造
+// 浏览器发出的跨站请求会带上 Origin 或 Referer，两者都没有时视为命令行等非浏览器客户端
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Referer()
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// path 拼接带挂载前缀的页面路径，各段会被转义
+func (h *Handler) path(segments ...string) string {
+	escaped := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		escaped = append(escaped, url.PathEscape(segment))
+	}
+	return h.pathPrefix + "/" + strings.Join(escaped, "/")
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+// barPercent 计算某天的数量相对于这段历史最大值的百分比，用于绘制柱状条
+func barPercent(value int64, history []*inspector.DailyStats) int64 {
+	var max int64
+	for _, daily := range history {
+		if daily.Processed > max {
+			max = daily.Processed
+		}
+		if daily.Failed > max {
+			max = daily.Failed
+		}
+	}
+	if max == 0 {
+		return 0
+	}
+	return value * 100 / max
+}
+
+func split(path string) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func match(pattern, segments []string) (map[string]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for idx, part := range pattern {
+		if strings.HasPrefix(part, ":") {
+			params[part[1:]] = segments[idx]
+			continue
+		}
+		if part != segments[idx] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
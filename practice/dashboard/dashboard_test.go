@@ -0,0 +1,67 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"practice/internal/testredis"
+)
+
+func TestPostRequiresSameOrigin(t *testing.T) {
+	mr, engine := testredis.New(t)
+	h := New(engine, "/admin")
+
+	cases := []struct {
+		name    string
+		origin  string
+		referer string
+		want    int
+	}{
+		{"cross origin", "http://evil.example", "", http.StatusForbidden},
+		{"cross referer", "", "http://evil.example/page", http.StatusForbidden},
+		{"same origin", "http://dash.local", "", http.StatusSeeOther},
+		{"same referer", "", "http://dash.local/admin/", http.StatusSeeOther},
+		{"no browser headers", "", "", http.StatusSeeOther},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://dash.local/admin/queues/emails/pause", nil)
+			if c.origin != "" {
+				r.Header.Set("Origin", c.origin)
+			}
+			if c.referer != "" {
+				r.Header.Set("Referer", c.referer)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != c.want {
+				t.Fatalf("status = %d, want %d", w.Code, c.want)
+			}
+			paused := mr.Exists(testredis.Namespace + ":paused")
+			if paused != (c.want == http.StatusSeeOther) {
+				t.Fatalf("paused = %v after status %d", paused, w.Code)
+			}
+			mr.Del(testredis.Namespace + ":paused")
+		})
+	}
+}
+
+// 没有队列时的提示行横跨表头的所有列
+func TestIndexEmptyRowSpansColumns(t *testing.T) {
+	_, engine := testredis.New(t)
+	h := New(engine, "/admin")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://dash.local/admin/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	want := fmt.Sprintf(`<td colspan="%d">没有队列</td>`, strings.Count(body, "<th>"))
+	if !strings.Contains(body, want) {
+		t.Fatalf("body does not contain %s", want)
+	}
+}
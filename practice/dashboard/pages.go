@@ -0,0 +1,126 @@
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"practice/inspector"
+)
+
+type taskAction func(ctx context.Context, name, taskID string) (bool, error)
+
+type indexPage struct {
+	Queues []*queueDetail
+}
+
+type queuePage struct {
+	Queue      *queueDetail
+	State      inspector.TaskState
+	States     []inspector.TaskState
+	Tasks      []*inspector.TaskInfo
+	Cursor     int64
+	NextCursor int64
+}
+
+var pageStates = []inspector.TaskState{
+	inspector.TaskStatePending,
+	inspector.TaskStateScheduled,
+	inspector.TaskStateRetry,
+	inspector.TaskStateDead,
+	inspector.TaskStatePrioritized,
+	inspector.TaskStateDeadline,
+}
+
+func (h *Handler) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := h.templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) pageIndex(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	details, err := h.listQueueDetails(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.render(w, "index.html", &indexPage{Queues: details})
+}
+
+func (h *Handler) pageQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	detail, err := h.getQueueDetail(r, params["queue"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state, cursor, count, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	infos, next, err := h.inspector.ListTasks(r.Context(), params["queue"], state, cursor, count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.render(w, "queue.html", &queuePage{
+		Queue:      detail,
+		State:      state,
+		States:     pageStates,
+		Tasks:      infos,
+		Cursor:     cursor,
+		NextCursor: next,
+	})
+}
+
+// 表单操作完成后跳回来源页面
+func (h *Handler) redirectBack(w http.ResponseWriter, r *http.Request, fallback string) {
+	target := r.Referer()
+	if target == "" {
+		target = fallback
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+func (h *Handler) actionPauseQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := h.inspector.PauseQueue(r.Context(), params["queue"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.redirectBack(w, r, h.path())
+}
+
+func (h *Handler) actionResumeQueue(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if err := h.inspector.ResumeQueue(r.Context(), params["queue"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.redirectBack(w, r, h.path())
+}
+
+func (h *Handler) actionCancelTask(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.actionTask(w, r, params, h.inspector.CancelTask)
+}
+
+func (h *Handler) actionRequeueDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.actionTask(w, r, params, h.inspector.RequeueDeadTask)
+}
+
+func (h *Handler) actionDeleteDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	h.actionTask(w, r, params, h.inspector.DeleteDeadTask)
+}
+
+func (h *Handler) actionTask(w http.ResponseWriter, r *http.Request, params map[string]string, action taskAction) {
+	if _, err := action(r.Context(), params["queue"], params["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.redirectBack(w, r, h.path("queues", params["queue"]))
+}
+
+func (h *Handler) actionRequeueAllDead(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if _, err := h.inspector.RequeueAllDeadTasks(r.Context(), params["queue"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.redirectBack(w, r, h.path("queues", params["queue"]))
+}
@@ -0,0 +1,361 @@
+// 动态扇出/扇入
+
+// 处理函数在运行中创建一批子任务，并登记一个回调任务，所有子任务结束后回调任务入队
+// 批次以父任务ID为标识，父任务重试时不会重复创建；子任务的完成和回调的入队都在 Lua 中原子完成，
+// 回调任务只会入队一次
+
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"practice/logging"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"practice/tracing"
+	"practice/worker"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MetadataBatch 子任务和回调任务的元数据中保存批次ID的key
+const MetadataBatch = "fanout_batch"
+
+// 子任务的结束状态
+const (
+	ChildCompleted = "completed"
+	ChildDead      = "dead"
+)
+
+// Child 一个待入队的任务
+type Child struct {
+	Queue string
+	Task  *taskstruct.Task
+}
+
+// BatchStatus 批次进度，回调任务可以通过它读取子任务的结果
+type BatchStatus struct {
+	ID      string                            `json:"id"`
+	Total   int                               `json:"total"`
+	Pending int                               `json:"pending"`
+	Failed  int                               `json:"failed"`
+	Fired   bool                              `json:"fired"`   // 回调任务是否已入队
+	Results map[string]map[string]interface{} `json:"results"` // 成功子任务ID->结果
+	Dead    []string                          `json:"dead"`    // 进入死信队列的子任务ID
+}
+
+// Key 批次的Hash，保存回调任务、计数和子任务结果
+func Key(namespace, batchID string) string {
+	return fmt.Sprintf("%s:fanout:%s", namespace, batchID)
+}
+
+// BatchID 返回子任务或回调任务所属的批次ID
+func BatchID(task *taskstruct.Task) string {
+	return task.Metadata[MetadataBatch]
+}
+
+// spawnScript 批次不存在时登记回调并把所有子任务入队，已存在时返回0
+// 回调任务或任一子任务的ID已存在时整个批次都不创建，返回-1，否则该子任务的结束不会推进批次
+// KEYS 依次为 任务Hash、批次Hash，之后每个子任务为 queue.ReadyKeys 返回的6个key
+// ARGV 依次为 回调任务体、回调任务key、回调任务ID、回调队列名、子任务数，之后每个子任务为 任务key、任务体、任务ID、租户、截止时间
+var spawnScript = redis.NewScript(queue.PushReadyLua + `
+if redis.call("EXISTS", KEYS[2]) == 1 then
+    return 0
+end
+
+local count = tonumber(ARGV[5])
+if redis.call("HEXISTS", KEYS[1], ARGV[2]) == 1 then
+    return -1
+end
+for i = 1, count do
+    if redis.call("HEXISTS", KEYS[1], ARGV[5 + (i - 1) * 5 + 1]) == 1 then
+        return -1
+    end
+end
+
+redis.call("HSET", KEYS[2], "callback", ARGV[1], "callback_id", ARGV[3], "callback_queue", ARGV[4], "total", count, "pending", count, "failed", 0)
+for i = 1, count do
+    local base = 5 + (i - 1) * 5
+    redis.call("HSET", KEYS[1], ARGV[base + 1], ARGV[base + 2])
+    pushReady(2 + (i - 1) * 6, ARGV[base + 3], ARGV[base + 4], ARGV[base + 5], false)
+end
+
+return 1
+`)
+
+// finishScript 记录一个子任务结束，同一个子任务只计一次；最后一个子任务结束时把回调任务入队并返回1
+// KEYS 依次为 任务Hash、批次Hash，之后为回调任务的 queue.ReadyKeys
+// ARGV 依次为 子任务ID、结束状态、结果、任务key前缀、结束后的保留时间(毫秒)、回调任务的租户、截止时间
+var finishScript = redis.NewScript(queue.PushReadyLua + `
+if redis.call("EXISTS", KEYS[2]) == 0 then
+    return 0
+end
+if redis.call("HSETNX", KEYS[2], "child:" .. ARGV[1], ARGV[2]) == 0 then
+    return 0
+end
+
+if ARGV[2] == "dead" then
+    redis.call("HINCRBY", KEYS[2], "failed", 1)
+elseif ARGV[3] ~= "" then
+    redis.call("HSET", KEYS[2], "result:" .. ARGV[1], ARGV[3])
+end
+
+if redis.call("HINCRBY", KEYS[2], "pending", -1) > 0 then
+    return 0
+end
+if redis.call("HSETNX", KEYS[2], "fired", 1) == 0 then
+    return 0
+end
+redis.call("PEXPIRE", KEYS[2], ARGV[5])
+
+local callbackID = redis.call("HGET", KEYS[2], "callback_id")
+local taskKey = ARGV[4] .. callbackID
+if redis.call("HSETNX", KEYS[1], taskKey, redis.call("HGET", KEYS[2], "callback")) == 0 then
+    return 0
+end
+pushReady(2, callbackID, ARGV[6], ARGV[7], false)
+
+return 1
+`)
+
+var _ worker.Hook = (*Fanout)(nil)
+
+// Fanout 供处理函数创建子任务，并作为 worker.Hook 在子任务结束时推进批次
+type Fanout struct {
+	redisEngine *redisengine.RedisEngine
+	retention   time.Duration
+	logger      logging.Logger
+	recorder    Recorder
+	tracer      tracing.Tracer
+}
+
+// Recorder 接收子任务和回调任务的入队事件，用于统计指标，metrics.Metrics 实现了该接口
+type Recorder interface {
+	TaskEnqueued(queue, taskType string)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) TaskEnqueued(queue, taskType string) {}
+
+// Option 扇出的可选配置，在构造函数中传入
+type Option func(*Fanout)
+
+// WithRetention 回调任务入队后批次结果的保留时间，默认7天
+func WithRetention(retention time.Duration) Option {
+	return func(f *Fanout) {
+		f.retention = retention
+	}
+}
+
+func WithLogger(logger logging.Logger) Option {
+	return func(f *Fanout) {
+		f.logger = logger
+	}
+}
+
+// WithRecorder 子任务和回调任务入队时计入入队数
+func WithRecorder(recorder Recorder) Option {
+	return func(f *Fanout) {
+		f.recorder = recorder
+	}
+}
+
+// WithTracer 为子任务和回调任务创建入队span，并通过任务元数据传递链路
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(f *Fanout) {
+		f.tracer = tracer
+	}
+}
+
+func New(redisEngine *redisengine.RedisEngine, opts ...Option) *Fanout {
+	f := &Fanout{
+		redisEngine: redisEngine,
+		retention:   7 * 24 * time.Hour,
+		logger:      logging.Nop{},
+		recorder:    nopRecorder{},
+		tracer:      tracing.NopTracer{},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *Fanout) key(batchID string) string {
+	return Key(f.redisEngine.GetName(), batchID)
+}
+
+// Spawn 在处理 parent 时创建子任务，所有子任务成功或进入死信队列后 callback 入队
+// 同一个父任务只会创建一次，父任务重试时再次调用直接返回 false
+// 子任务或回调任务的ID已存在时不创建批次，返回 queue.ErrDuplicateTask
+func (f *Fanout) Spawn(ctx context.Context, parent *taskstruct.Task, children []Child, callback Child) (bool, error) {
+	if len(children) == 0 {
+		return false, fmt.Errorf("至少需要一个子任务")
+	}
+	seen := map[string]bool{callback.Task.ID: true}
+	for _, child := range children {
+		if seen[child.Task.ID] {
+			return false, fmt.Errorf("%w: %s", queue.ErrDuplicateTask, child.Task.ID)
+		}
+		seen[child.Task.ID] = true
+	}
+
+	batchID := parent.ID
+	now := time.Now().UnixMilli()
+	spans := make([]tracing.Span, 0, len(children)+1)
+	defer func() {
+		for _, span := range spans {
+			span.End()
+		}
+	}()
+	prepare := func(child Child) ([]byte, error) {
+		if child.Task.Metadata == nil {
+			child.Task.Metadata = make(map[string]string)
+		}
+		child.Task.Metadata[MetadataBatch] = batchID
+		// 回调任务的等待时间从批次创建开始计算
+		child.Task.ReadyAt = now
+		_, span := tracing.StartEnqueueSpan(ctx, f.tracer, child.Queue, child.Task)
+		spans = append(spans, span)
+		return json.Marshal(child.Task)
+	}
+	recordError := func(err error) {
+		for _, span := range spans {
+			span.RecordError(err)
+		}
+	}
+
+	callbackData, err := prepare(callback)
+	if err != nil {
+		return false, fmt.Errorf("序列化回调任务失败: %w", err)
+	}
+
+	keys := []string{f.redisEngine.GetName(), f.key(batchID)}
+	args := []interface{}{callbackData, callback.Task.GetTaskKey(), callback.Task.ID, callback.Queue, len(children)}
+	for _, child := range children {
+		childData, err := prepare(child)
+		if err != nil {
+			return false, fmt.Errorf("序列化子任务失败: %w", err)
+		}
+		tenant, deadline := queue.ReadyRoute(child.Task)
+		keys = append(keys, queue.ReadyKeys(f.redisEngine, child.Queue, tenant)...)
+		args = append(args, child.Task.GetTaskKey(), childData, child.Task.ID, tenant, deadline)
+	}
+
+	result, err := f.redisEngine.RunScript(ctx, spawnScript, keys, args...)
+	if err != nil {
+		recordError(err)
+		return false, fmt.Errorf("创建子任务失败: %w", err)
+	}
+	switch result.(int64) {
+	case 0:
+		f.logger.Debug("fanout batch already spawned", "batch", batchID)
+		return false, nil
+	case -1:
+		err := fmt.Errorf("%w: 批次 %s 中的任务ID已被使用", queue.ErrDuplicateTask, batchID)
+		recordError(err)
+		return false, err
+	}
+	for _, child := range children {
+		f.recorder.TaskEnqueued(child.Queue, child.Task.Type)
+	}
+	f.logger.Info("fanout batch spawned", "batch", batchID, "children", len(children))
+	return true, nil
+}
+
+// TaskCompleted 子任务成功，保存结果
+func (f *Fanout) TaskCompleted(ctx context.Context, task *taskstruct.Task) error {
+	return f.finish(ctx, task, ChildCompleted)
+}
+
+// TaskDead 子任务进入死信队列，计入失败数
+func (f *Fanout) TaskDead(ctx context.Context, task *taskstruct.Task) error {
+	return f.finish(ctx, task, ChildDead)
+}
+
+func (f *Fanout) finish(ctx context.Context, task *taskstruct.Task, state string) error {
+	batchID := BatchID(task)
+	if batchID == "" {
+		return nil
+	}
+
+	values, err := f.redisEngine.HMGet(ctx, f.key(batchID), "callback_queue", "callback_id", "callback")
+	if err != nil {
+		return fmt.Errorf("读取批次 %s 失败: %w", batchID, err)
+	}
+	callbackQueue, ok := values[0].(string)
+	if !ok {
+		// 批次已过期
+		return nil
+	}
+	// 回调任务也带有批次ID，它的结束不计入批次
+	callbackID, _ := values[1].(string)
+	if callbackID == task.ID {
+		return nil
+	}
+	callbackData, _ := values[2].(string)
+	callback := &taskstruct.Task{}
+	if err := json.Unmarshal([]byte(callbackData), callback); err != nil {
+		return fmt.Errorf("反序列化回调任务失败: %w", err)
+	}
+
+	result := ""
+	if task.Result != nil {
+		data, err := json.Marshal(task.Result)
+		if err != nil {
+			return fmt.Errorf("序列化任务结果失败: %w", err)
+		}
+		result = string(data)
+	}
+
+	tenant, deadline := queue.ReadyRoute(callback)
+	keys := append([]string{f.redisEngine.GetName(), f.key(batchID)}, queue.ReadyKeys(f.redisEngine, callbackQueue, tenant)...)
+	fired, err := f.redisEngine.RunScript(ctx, finishScript, keys, task.ID, state, result, taskstruct.TaskKeyPrefix, f.retention.Milliseconds(), tenant, deadline)
+	if err != nil {
+		return fmt.Errorf("更新批次 %s 失败: %w", batchID, err)
+	}
+	if fired.(int64) == 1 {
+		f.recorder.TaskEnqueued(callbackQueue, callback.Type)
+		f.logger.Info("fanout batch finished, callback enqueued", "batch", batchID, "callback_id", callbackID)
+	}
+	return nil
+}
+
+// Status 返回批次进度和子任务结果
+func (f *Fanout) Status(ctx context.Context, batchID string) (*BatchStatus, error) {
+	values, err := f.redisEngine.HGetAll(ctx, f.key(batchID))
+	if err != nil {
+		return nil, fmt.Errorf("读取批次失败: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("批次 %s 不存在", batchID)
+	}
+
+	status := &BatchStatus{
+		ID:      batchID,
+		Fired:   values["fired"] != "",
+		Results: make(map[string]map[string]interface{}),
+		Dead:    []string{},
+	}
+	status.Total, _ = strconv.Atoi(values["total"])
+	status.Pending, _ = strconv.Atoi(values["pending"])
+	status.Failed, _ = strconv.Atoi(values["failed"])
+	for field, value := range values {
+		if id, ok := strings.CutPrefix(field, "result:"); ok {
+			result := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(value), &result); err == nil {
+				status.Results[id] = result
+			}
+		}
+		if id, ok := strings.CutPrefix(field, "child:"); ok && value == ChildDead {
+			status.Dead = append(status.Dead, id)
+		}
+	}
+	return status, nil
+}
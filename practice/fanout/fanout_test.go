@@ -0,0 +1,165 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+	"practice/tracing"
+)
+
+func TestSpawnAndFinish(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	f := New(engine)
+	parent := taskstruct.NewTask("split", nil, 3)
+	children := []Child{
+		{Queue: "parts", Task: taskstruct.NewTask("part", nil, 3)},
+		{Queue: "parts", Task: taskstruct.NewTask("part", nil, 3)},
+	}
+	callback := Child{Queue: "merge", Task: taskstruct.NewTask("merge", nil, 3)}
+
+	spawned, err := f.Spawn(ctx, parent, children, callback)
+	if err != nil || !spawned {
+		t.Fatalf("Spawn = %v, %v, want true", spawned, err)
+	}
+	// 父任务重试时不会重复创建
+	if spawned, err := f.Spawn(ctx, parent, children, callback); err != nil || spawned {
+		t.Fatalf("second Spawn = %v, %v, want false", spawned, err)
+	}
+	if pending, _ := engine.LLen(ctx, queue.QueueKey(queue.KindQueue, "parts")); pending != 2 {
+		t.Fatalf("children pending = %d, want 2", pending)
+	}
+
+	parts := queue.NewQueue("parts", engine)
+	first, err := parts.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Result = map[string]interface{}{"size": 1}
+	if err := f.TaskCompleted(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个子任务重复上报只计一次
+	if err := f.TaskCompleted(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	merge := queue.NewQueue("merge", engine)
+	if _, err := merge.DequeueTask(ctx); err != queue.ErrQueueEmpty {
+		t.Fatalf("callback dequeue error = %v, want ErrQueueEmpty before all children finish", err)
+	}
+
+	second, err := parts.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.TaskDead(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	got, err := merge.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != callback.Task.ID || BatchID(got) != parent.ID {
+		t.Fatalf("callback = %+v, want %s in batch %s", got, callback.Task.ID, parent.ID)
+	}
+
+	status, err := f.Status(ctx, parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Fired || status.Pending != 0 || status.Failed != 1 || len(status.Results) != 1 || len(status.Dead) != 1 {
+		t.Fatalf("status = %+v, want fired with one result and one dead child", status)
+	}
+	// 回调任务结束不计入批次
+	if err := f.TaskCompleted(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type enqueueRecorder struct {
+	enqueued map[string]int
+}
+
+func (r *enqueueRecorder) TaskEnqueued(queue, taskType string) {
+	r.enqueued[queue]++
+}
+
+// 子任务的ID已存在时整个批次都不创建，已有任务不会被覆盖
+func TestSpawnRejectsExistingChildID(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	f := New(engine)
+	existing := taskstruct.NewTask("part", nil, 3)
+	if err := queue.NewQueue("parts", engine).EnqueueTask(ctx, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := taskstruct.NewTask("split", nil, 3)
+	children := []Child{
+		{Queue: "parts", Task: taskstruct.NewTask("part", nil, 3)},
+		{Queue: "parts", Task: &taskstruct.Task{ID: existing.ID, Type: "part"}},
+	}
+	callback := Child{Queue: "merge", Task: taskstruct.NewTask("merge", nil, 3)}
+	spawned, err := f.Spawn(ctx, parent, children, callback)
+	if !errors.Is(err, queue.ErrDuplicateTask) || spawned {
+		t.Fatalf("Spawn = %v, %v, want ErrDuplicateTask", spawned, err)
+	}
+	if pending, _ := engine.LLen(ctx, queue.QueueKey(queue.KindQueue, "parts")); pending != 1 {
+		t.Fatalf("children pending = %d, want only the existing task", pending)
+	}
+	if _, err := f.Status(ctx, parent.ID); err == nil {
+		t.Fatal("batch was created for a rejected spawn")
+	}
+	stored, err := queue.NewQueue("parts", engine).DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BatchID(stored) != "" {
+		t.Fatalf("existing task metadata = %v, want it untouched", stored.Metadata)
+	}
+}
+
+// 子任务和回调任务与直接入队时一样按租户路由，留下唤醒信号、入队span和入队数
+func TestSpawnRoutesLikeEnqueue(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	recorder := &enqueueRecorder{enqueued: map[string]int{}}
+	tracer := tracing.NewRecorder()
+	f := New(engine, WithRecorder(recorder), WithTracer(tracer))
+
+	parent := taskstruct.NewTask("split", nil, 3)
+	child := taskstruct.NewTask("part", nil, 3)
+	child.Tenant = "acme"
+	callback := taskstruct.NewTask("merge", nil, 3)
+	callback.Tenant = "acme"
+	if _, err := f.Spawn(ctx, parent, []Child{{Queue: "parts", Task: child}}, Child{Queue: "merge", Task: callback}); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := engine.LRange(ctx, queue.TenantKey(testredis.Namespace, "parts", "acme"), 0, -1); len(ids) != 1 || ids[0] != child.ID {
+		t.Fatalf("tenant list = %v, want [%s]", ids, child.ID)
+	}
+	if signals, _ := engine.LLen(ctx, queue.NotifyKey(testredis.Namespace, "parts")); signals != 1 {
+		t.Fatalf("notify signals = %d, want 1", signals)
+	}
+	if len(tracer.Spans()) != 2 || child.Metadata[tracing.TraceParentKey] == "" {
+		t.Fatalf("spans = %d, metadata = %v, want enqueue spans for the child and the callback", len(tracer.Spans()), child.Metadata)
+	}
+
+	got, err := queue.NewQueue("parts", engine).DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.TaskCompleted(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := engine.LRange(ctx, queue.TenantKey(testredis.Namespace, "merge", "acme"), 0, -1); len(ids) != 1 || ids[0] != callback.ID {
+		t.Fatalf("callback tenant list = %v, want [%s]", ids, callback.ID)
+	}
+	if recorder.enqueued["parts"] != 1 || recorder.enqueued["merge"] != 1 {
+		t.Fatalf("enqueued = %v, want one child and one callback", recorder.enqueued)
+	}
+}
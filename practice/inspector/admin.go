@@ -0,0 +1,167 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cancelScript 从就绪、延迟、重试、优先级队列、截止时间ZSet以及租户子列表或分组ZSet(KEYS[7]，可选)中移除任务并删除任务体
+// ARGV[3] 为 KEYS[7] 的类型，"group" 表示分组ZSet，否则为租户子列表；
+// 租户子列表因此变空时把租户 ARGV[4] 从租户环 KEYS[8] 中移除并清除它在 KEYS[9] 中的赤字
+var cancelScript = redis.NewScript(`
+local removed = redis.call("LREM", KEYS[2], 0, ARGV[2])
+for i = 3, 6 do
+    removed = removed + redis.call("ZREM", KEYS[i], ARGV[2])
+end
+if KEYS[7] then
+    if ARGV[3] == "group" then
+        removed = removed + redis.call("ZREM", KEYS[7], ARGV[2])
+    else
+        removed = removed + redis.call("LREM", KEYS[7], 0, ARGV[2])
+        if redis.call("LLEN", KEYS[7]) == 0 then
+            redis.call("LREM", KEYS[8], 0, ARGV[4])
+            redis.call("HDEL", KEYS[9], ARGV[4])
+        end
+    end
+end
+if removed == 0 then
+    return 0
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+return 1
+`)
+
+// requeueDeadScript 把死信任务移回就绪队列，按租户和截止时间的路由与直接入队时相同
+// KEYS 依次为 任务Hash、死信列表，之后为 queue.ReadyKeys 返回的key
+// ARGV 依次为 任务key、任务体、任务ID、租户、截止时间
+var requeueDeadScript = redis.NewScript(queue.PushReadyLua + `
+if redis.call("LREM", KEYS[2], 1, ARGV[3]) == 0 then
+    return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+pushReady(2, ARGV[3], ARGV[4], ARGV[5], false)
+return 1
+`)
+
+// deleteDeadScript 删除死信任务
+var deleteDeadScript = redis.NewScript(`
+if redis.call("LREM", KEYS[2], 0, ARGV[2]) == 0 then
+    return 0
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+return 1
+`)
+
+// PauseQueue 暂停队列，暂停后该名称下所有种类的队列出队都返回空
+func (i *Inspector) PauseQueue(ctx context.Context, name string) error {
+	return i.redisEngine.SAdd(ctx, i.redisEngine.GetPausedKey(), name)
+}
+
+func (i *Inspector) ResumeQueue(ctx context.Context, name string) error {
+	return i.redisEngine.SRem(ctx, i.redisEngine.GetPausedKey(), name)
+}
+
+func (i *Inspector) IsPaused(ctx context.Context, name string) (bool, error) {
+	return i.redisEngine.SIsMember(ctx, i.redisEngine.GetPausedKey(), name)
+}
+
+// CancelTask 取消尚未执行的任务，返回任务是否存在
+func (i *Inspector) CancelTask(ctx context.Context, name, taskID string) (bool, error) {
+	task := taskstruct.Task{ID: taskID}
+	keys := []string{
+		i.redisEngine.GetName(),
+		queue.QueueKey(queue.KindQueue, name),
+		queue.QueueKey(queue.KindDelay, name),
+		queue.QueueKey(queue.KindRetry, name),
+		queue.QueueKey(queue.KindDeadline, name),
+		queue.QueueKey(queue.KindPriority, name),
+	}
+	// 分组任务在分组ZSet中，租户任务在租户子列表中，需要先读取任务体才能知道所属分组和租户
+	extraKind, tenant := "", ""
+	if body, err := i.GetTask(ctx, taskID); err == nil {
+		if body.Group != "" {
+			extraKind = "group"
+			keys = append(keys, queue.GroupKey(i.redisEngine.GetName(), name, body.Group))
+		} else if body.Tenant != "" {
+			extraKind, tenant = "tenant", body.Tenant
+			keys = append(keys,
+				queue.TenantKey(i.redisEngine.GetName(), name, body.Tenant),
+				queue.TenantsKey(i.redisEngine.GetName(), name),
+				queue.DeficitKey(i.redisEngine.GetName(), name),
+			)
+		}
+	}
+	result, err := i.redisEngine.RunScript(ctx, cancelScript, keys, task.GetTaskKey(), taskID, extraKind, tenant)
+	if err != nil {
+		return false, fmt.Errorf("取消任务失败: %w", err)
+	}
+	return result.(int64) == 1, nil
+}
+
+// RequeueDeadTask 把死信任务重置重试次数后放回就绪队列，返回任务是否存在
+func (i *Inspector) RequeueDeadTask(ctx context.Context, name, taskID string) (bool, error) {
+	task, err := i.GetTask(ctx, taskID)
+	if err != nil {
+		if errors.Is(err, queue.ErrTaskNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	task.Retry = 0
+	task.Status = taskstruct.TaskStatusPending
+	task.ReadyAt = time.Now().UnixMilli()
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return false, fmt.Errorf("序列化任务失败: %w", err)
+	}
+	tenant, deadline := queue.ReadyRoute(task)
+	keys := append([]string{i.redisEngine.GetName(), queue.QueueKey(queue.KindDead, name)}, queue.ReadyKeys(i.redisEngine, name, tenant)...)
+	result, err := i.redisEngine.RunScript(ctx, requeueDeadScript, keys, task.GetTaskKey(), taskData, taskID, tenant, deadline)
+	if err != nil {
+		return false, fmt.Errorf("死信任务重新入队失败: %w", err)
+	}
+	return result.(int64) == 1, nil
+}
+
+// RequeueAllDeadTasks 把某队列的全部死信任务放回就绪队列，返回移动的数量
+func (i *Inspector) RequeueAllDeadTasks(ctx context.Context, name string) (int, error) {
+	taskIDs, err := i.redisEngine.LRange(ctx, queue.QueueKey(queue.KindDead, name), 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, taskID := range taskIDs {
+		ok, err := i.RequeueDeadTask(ctx, name, taskID)
+		if err != nil {
+			return moved, err
+		}
+		if ok {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// DeleteDeadTask 删除死信任务及其任务体，返回任务是否存在
+func (i *Inspector) DeleteDeadTask(ctx context.Context, name, taskID string) (bool, error) {
+	task := taskstruct.Task{ID: taskID}
+	keys := []string{i.redisEngine.GetName(), queue.QueueKey(queue.KindDead, name)}
+	result, err := i.redisEngine.RunScript(ctx, deleteDeadScript, keys, task.GetTaskKey(), taskID)
+	if err != nil {
+		return false, fmt.Errorf("删除死信任务失败: %w", err)
+	}
+	return result.(int64) == 1, nil
+}
+
+// OrphanTasks 返回出队时发现任务体已丢失的任务ID
+func (i *Inspector) OrphanTasks(ctx context.Context) ([]string, error) {
+	return i.redisEngine.SMembers(ctx, i.redisEngine.GetOrphansKey())
+}
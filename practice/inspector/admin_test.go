@@ -0,0 +1,114 @@
+package inspector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+func TestCancelGroupTask(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	task := taskstruct.NewTask("notify", nil, 3)
+	task.Group = "user-1"
+	if err := queue.NewQueue("notify", engine).EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := NewInspector(engine).CancelTask(ctx, "notify", task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("CancelTask found = false, want true")
+	}
+	size, err := engine.ZCard(ctx, queue.GroupKey("test", "notify", "user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Fatalf("group size = %d, want 0", size)
+	}
+}
+
+func TestCancelPriorityTask(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Priority = 3
+	if err := queue.NewPriorityQueue("emails", engine).EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := NewInspector(engine).CancelTask(ctx, "emails", task.ID)
+	if err != nil || !found {
+		t.Fatalf("CancelTask = %v, %v, want true", found, err)
+	}
+	size, err := engine.ZCard(ctx, queue.QueueKey(queue.KindPriority, "emails"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Fatalf("priority queue size = %d, want 0", size)
+	}
+}
+
+// 死信任务重新入队后仍在截止时间ZSet中，并计入就绪任务数
+func TestRequeueDeadTaskKeepsDeadline(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Deadline = time.Now().Add(time.Hour)
+	if err := queue.NewDeadQueue("emails", engine).EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	i := NewInspector(engine)
+	found, err := i.RequeueDeadTask(ctx, "emails", task.ID)
+	if err != nil || !found {
+		t.Fatalf("RequeueDeadTask = %v, %v, want true", found, err)
+	}
+	stats, err := i.GetQueueStats(ctx, "emails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 1 || stats.Deadline != 1 || stats.Dead != 0 {
+		t.Fatalf("stats = %+v, want one pending task with a deadline", stats)
+	}
+}
+
+// 取消租户的最后一个任务时租户离开租户环，就绪任务数包含租户子列表
+func TestCancelTenantTask(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("emails", engine)
+	first := taskstruct.NewTask("send", nil, 3)
+	first.Tenant = "acme"
+	second := taskstruct.NewTask("send", nil, 3)
+	second.Tenant = "globex"
+	for _, task := range []*taskstruct.Task{first, second} {
+		if err := q.EnqueueTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	i := NewInspector(engine)
+	if stats, err := i.GetQueueStats(ctx, "emails"); err != nil || stats.Pending != 2 {
+		t.Fatalf("stats = %+v (%v), want 2 pending", stats, err)
+	}
+	found, err := i.CancelTask(ctx, "emails", first.ID)
+	if err != nil || !found {
+		t.Fatalf("CancelTask = %v, %v, want true", found, err)
+	}
+	tenants, err := q.Tenants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0] != "globex" {
+		t.Fatalf("tenants = %v, want [globex]", tenants)
+	}
+}
@@ -0,0 +1,393 @@
+// 队列检查器
+
+// 只读地统计队列大小、每日处理数，并分页列出各状态的任务
+
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type TaskState string
+
+const (
+	TaskStatePending   TaskState = "pending"   // 就绪，位于普通队列的列表或租户子列表
+	TaskStateScheduled TaskState = "scheduled" // 延迟中，位于延迟队列
+	TaskStateRetry     TaskState = "retry"     // 等待重试，位于重试队列
+	TaskStateDead      TaskState = "dead"      // 死信
+
+	TaskStatePrioritized TaskState = "prioritized" // 就绪，位于优先级队列
+	TaskStateDeadline    TaskState = "deadline"    // 就绪且带截止时间，按截止时间排列，同时也在就绪列表中
+)
+
+// 每种状态对应的队列种类
+var stateKinds = map[TaskState]string{
+	TaskStatePending:   queue.KindQueue,
+	TaskStateScheduled: queue.KindDelay,
+	TaskStateRetry:     queue.KindRetry,
+	TaskStateDead:      queue.KindDead,
+
+	TaskStatePrioritized: queue.KindPriority,
+	TaskStateDeadline:    queue.KindDeadline,
+}
+
+type QueueStats struct {
+	Queue            string        `json:"queue"`
+	Pending          int64         `json:"pending"`
+	Scheduled        int64         `json:"scheduled"`
+	Retry            int64         `json:"retry"`
+	Dead             int64         `json:"dead"`
+	Prioritized      int64         `json:"prioritized"`
+	Deadline         int64         `json:"deadline"`           // 就绪任务中带截止时间的任务数，已计入 Pending
+	OldestPendingAge time.Duration `json:"oldest_pending_age"` // 最早就绪任务的等待时长
+	Processed        int64         `json:"processed"`          // 当天处理成功数
+	Failed           int64         `json:"failed"`             // 当天处理失败数
+	Timestamp        time.Time     `json:"timestamp"`
+}
+
+type DailyStats struct {
+	Queue     string    `json:"queue"`
+	Date      time.Time `json:"date"`
+	Processed int64     `json:"processed"`
+	Failed    int64     `json:"failed"`
+}
+
+type TaskInfo struct {
+	ID        string           `json:"id"`
+	State     TaskState        `json:"state"`
+	Task      *taskstruct.Task `json:"task,omitempty"`        // 任务体已丢失时为空
+	NextRunAt time.Time        `json:"next_run_at,omitempty"` // 延迟和重试任务的下次执行时间
+}
+
+type Inspector struct {
+	redisEngine *redisengine.RedisEngine
+}
+
+func NewInspector(redisEngine *redisengine.RedisEngine) *Inspector {
+	return &Inspector{redisEngine: redisEngine}
+}
+
+// Queues 返回所有注册过的队列名称，按名称排序
+func (i *Inspector) Queues(ctx context.Context) ([]string, error) {
+	queueKeys, err := i.redisEngine.SMembers(ctx, i.redisEngine.GetQueuesKey())
+	if err != nil {
+		return nil, fmt.Errorf("读取队列列表失败: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, queueKey := range queueKeys {
+		_, name, ok := queue.ParseQueueKey(queueKey)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetQueueStats 返回某个队列名称下各状态的任务数以及当天的处理统计
+func (i *Inspector) GetQueueStats(ctx context.Context, name string) (*QueueStats, error) {
+	now := time.Now()
+	stats := &QueueStats{Queue: name, Timestamp: now}
+
+	var err error
+	if stats.Pending, err = i.pendingCount(ctx, name); err != nil {
+		return nil, err
+	}
+	if stats.Scheduled, err = i.redisEngine.ZCard(ctx, queue.QueueKey(queue.KindDelay, name)); err != nil {
+		return nil, err
+	}
+	if stats.Retry, err = i.redisEngine.ZCard(ctx, queue.QueueKey(queue.KindRetry, name)); err != nil {
+		return nil, err
+	}
+	if stats.Dead, err = i.redisEngine.LLen(ctx, queue.QueueKey(queue.KindDead, name)); err != nil {
+		return nil, err
+	}
+	if stats.Prioritized, err = i.redisEngine.ZCard(ctx, queue.QueueKey(queue.KindPriority, name)); err != nil {
+		return nil, err
+	}
+	if stats.Deadline, err = i.redisEngine.ZCard(ctx, queue.QueueKey(queue.KindDeadline, name)); err != nil {
+		return nil, err
+	}
+
+	if stats.OldestPendingAge, err = i.oldestPendingAge(ctx, name, now); err != nil {
+		return nil, err
+	}
+
+	daily, err := i.getDailyStats(ctx, name, now)
+	if err != nil {
+		return nil, err
+	}
+	stats.Processed = daily.Processed
+	stats.Failed = daily.Failed
+	return stats, nil
+}
+
+// History 返回最近 days 天的每日统计，今天排在最前
+func (i *Inspector) History(ctx context.Context, name string, days int) ([]*DailyStats, error) {
+	now := time.Now()
+	history := make([]*DailyStats, 0, days)
+	for d := 0; d < days; d++ {
+		daily, err := i.getDailyStats(ctx, name, now.AddDate(0, 0, -d))
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, daily)
+	}
+	return history, nil
+}
+
+// ListTasks 分页列出某状态下的任务，cursor 从 0 开始，返回的下一页 cursor 为 0 表示没有更多
+// 就绪、死信、优先级队列和带截止时间的任务按出队顺序排列，延迟和重试任务按执行时间排列
+// 就绪任务先列出普通列表，再按租户环的顺序列出各租户子列表，每个列表内按出队顺序
+func (i *Inspector) ListTasks(ctx context.Context, name string, state TaskState, cursor, count int64) ([]*TaskInfo, int64, error) {
+	kind, ok := stateKinds[state]
+	if !ok {
+		return nil, 0, fmt.Errorf("无效状态 %s", state)
+	}
+	if cursor < 0 || count <= 0 {
+		return nil, 0, fmt.Errorf("无效分页参数 cursor=%d count=%d", cursor, count)
+	}
+	queueKey := queue.QueueKey(kind, name)
+
+	infos := []*TaskInfo{}
+	switch kind {
+	case queue.KindQueue:
+		listKeys, err := i.pendingLists(ctx, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		taskIDs, err := i.pageLists(ctx, listKeys, cursor, count)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, taskID := range taskIDs {
+			infos = append(infos, &TaskInfo{ID: taskID, State: state})
+		}
+	case queue.KindDead:
+		taskIDs, err := i.pageLists(ctx, []string{queueKey}, cursor, count)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, taskID := range taskIDs {
+			infos = append(infos, &TaskInfo{ID: taskID, State: state})
+		}
+	case queue.KindPriority:
+		members, err := i.redisEngine.ZRevRangeWithScores(ctx, queueKey, cursor, cursor+count-1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取队列 %s 失败: %w", queueKey, err)
+		}
+		for _, member := range members {
+			infos = append(infos, &TaskInfo{ID: member.Member.(string), State: state})
+		}
+	case queue.KindDeadline:
+		members, err := i.redisEngine.ZRangeWithScores(ctx, queueKey, cursor, cursor+count-1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取队列 %s 失败: %w", queueKey, err)
+		}
+		for _, member := range members {
+			infos = append(infos, &TaskInfo{ID: member.Member.(string), State: state})
+		}
+	default:
+		members, err := i.redisEngine.ZRangeWithScores(ctx, queueKey, cursor, cursor+count-1)
+		if err != nil {
+			return nil, 0, fmt.Errorf("读取队列 %s 失败: %w", queueKey, err)
+		}
+		for _, member := range members {
+			infos = append(infos, &TaskInfo{
+				ID:        member.Member.(string),
+				State:     state,
+				NextRunAt: time.UnixMilli(int64(member.Score)),
+			})
+		}
+	}
+
+	if err := i.fillTasks(ctx, infos); err != nil {
+		return nil, 0, err
+	}
+
+	var next int64
+	if int64(len(infos)) == count {
+		next = cursor + count
+	}
+	return infos, next, nil
+}
+
+// GetTask 读取任务体，不存在时返回 queue.ErrTaskNotFound
+func (i *Inspector) GetTask(ctx context.Context, taskID string) (*taskstruct.Task, error) {
+	task := taskstruct.Task{ID: taskID}
+	taskData, err := i.redisEngine.HGet(ctx, i.redisEngine.GetName(), task.GetTaskKey())
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("%w: %s", queue.ErrTaskNotFound, taskID)
+		}
+		return nil, fmt.Errorf("读取任务失败: %w", err)
+	}
+	if err := json.Unmarshal([]byte(taskData), &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+	return &task, nil
+}
+
+// 批量读取任务体
+func (i *Inspector) fillTasks(ctx context.Context, infos []*TaskInfo) error {
+	if len(infos) == 0 {
+		return nil
+	}
+	taskKeys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		taskKeys = append(taskKeys, (&taskstruct.Task{ID: info.ID}).GetTaskKey())
+	}
+	values, err := i.redisEngine.HMGet(ctx, i.redisEngine.GetName(), taskKeys...)
+	if err != nil {
+		return fmt.Errorf("读取任务失败: %w", err)
+	}
+	for idx, value := range values {
+		taskData, ok := value.(string)
+		if !ok {
+			continue
+		}
+		task := &taskstruct.Task{}
+		if err := json.Unmarshal([]byte(taskData), task); err != nil {
+			return fmt.Errorf("反序列化任务失败: %w", err)
+		}
+		infos[idx].Task = task
+	}
+	return nil
+}
+
+// pendingLists 就绪列表和有任务的租户子列表
+func (i *Inspector) pendingLists(ctx context.Context, name string) ([]string, error) {
+	tenants, err := i.redisEngine.LRange(ctx, queue.TenantsKey(i.redisEngine.GetName(), name), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("读取租户失败: %w", err)
+	}
+	listKeys := []string{queue.QueueKey(queue.KindQueue, name)}
+	for _, tenant := range tenants {
+		// 租户 "" 表示就绪列表本身
+		if tenant != "" {
+			listKeys = append(listKeys, queue.TenantKey(i.redisEngine.GetName(), name, tenant))
+		}
+	}
+	return listKeys, nil
+}
+
+// pageLists 把多个列表按顺序拼接后分页，每个列表内按出队顺序返回任务ID
+func (i *Inspector) pageLists(ctx context.Context, listKeys []string, cursor, count int64) ([]string, error) {
+	taskIDs := []string{}
+	skip := cursor
+	for _, listKey := range listKeys {
+		remaining := count - int64(len(taskIDs))
+		if remaining <= 0 {
+			break
+		}
+		size, err := i.redisEngine.LLen(ctx, listKey)
+		if err != nil {
+			return nil, fmt.Errorf("读取队列 %s 失败: %w", listKey, err)
+		}
+		if skip >= size {
+			skip -= size
+			continue
+		}
+		// 列表左进右出，从右端开始才是出队顺序
+		ids, err := i.redisEngine.LRange(ctx, listKey, -(skip + remaining), -(skip + 1))
+		if err != nil {
+			return nil, fmt.Errorf("读取队列 %s 失败: %w", listKey, err)
+		}
+		for idx := len(ids) - 1; idx >= 0; idx-- {
+			taskIDs = append(taskIDs, ids[idx])
+		}
+		skip = 0
+	}
+	return taskIDs, nil
+}
+
+// pendingCount 就绪列表和所有租户子列表中的任务数之和
+func (i *Inspector) pendingCount(ctx context.Context, name string) (int64, error) {
+	listKeys, err := i.pendingLists(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, listKey := range listKeys {
+		size, err := i.redisEngine.LLen(ctx, listKey)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// oldestPendingAge 就绪列表和租户子列表出队端的任务中等待最久的时长
+func (i *Inspector) oldestPendingAge(ctx context.Context, name string, now time.Time) (time.Duration, error) {
+	listKeys, err := i.pendingLists(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	var oldest time.Duration
+	for _, listKey := range listKeys {
+		taskID, err := i.redisEngine.LIndex(ctx, listKey, -1)
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			return 0, err
+		}
+		task, err := i.GetTask(ctx, taskID)
+		if err != nil {
+			if errors.Is(err, queue.ErrTaskNotFound) {
+				continue
+			}
+			return 0, err
+		}
+		if age := now.Sub(task.ReadyTime()); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest, nil
+}
+
+func (i *Inspector) getDailyStats(ctx context.Context, name string, day time.Time) (*DailyStats, error) {
+	namespace := i.redisEngine.GetName()
+	processed, err := i.getCounter(ctx, queue.ProcessedKey(namespace, name, day))
+	if err != nil {
+		return nil, err
+	}
+	failed, err := i.getCounter(ctx, queue.FailedKey(namespace, name, day))
+	if err != nil {
+		return nil, err
+	}
+	year, month, date := day.Date()
+	return &DailyStats{
+		Queue:     name,
+		Date:      time.Date(year, month, date, 0, 0, 0, 0, day.Location()),
+		Processed: processed,
+		Failed:    failed,
+	}, nil
+}
+
+func (i *Inspector) getCounter(ctx context.Context, key string) (int64, error) {
+	value, err := i.redisEngine.Get(ctx, key)
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
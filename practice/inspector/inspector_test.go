@@ -0,0 +1,180 @@
+package inspector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// enqueueTasks 向普通队列放入 count 个任务，按入队顺序返回
+func enqueueTasks(t *testing.T, q *queue.Queue, count int) []*taskstruct.Task {
+	t.Helper()
+	tasks := make([]*taskstruct.Task, 0, count)
+	for i := 0; i < count; i++ {
+		task := taskstruct.NewTask("send", nil, 3)
+		if err := q.EnqueueTask(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+func TestGetQueueStats(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("emails", engine)
+	enqueueTasks(t, q, 3)
+	if err := queue.NewDelayQueue("emails", engine, 0).ScheduleTask(ctx, taskstruct.NewTask("send", nil, 3), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.NewRetryQueue("emails", engine, time.Minute, time.Hour, 3).EnqueueTask(ctx, taskstruct.NewTask("send", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	processed, err := q.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.AckTask(ctx, processed); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	stats, err := NewInspector(engine).GetQueueStats(ctx, "emails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != 2 || stats.Scheduled != 1 || stats.Retry != 1 || stats.Dead != 0 {
+		t.Fatalf("stats = %+v, want 2 pending, 1 scheduled, 1 retry", stats)
+	}
+	if stats.Processed != 1 || stats.Failed != 1 {
+		t.Fatalf("daily = %d processed, %d failed, want 1 and 1", stats.Processed, stats.Failed)
+	}
+	if stats.OldestPendingAge < 20*time.Millisecond || stats.OldestPendingAge > time.Minute {
+		t.Fatalf("oldest pending age = %v, want the wait of the head task", stats.OldestPendingAge)
+	}
+}
+
+// 就绪列表按出队顺序分页，最后一页不满时 next 为 0
+func TestListTasksPages(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	tasks := enqueueTasks(t, queue.NewQueue("emails", engine), 5)
+	i := NewInspector(engine)
+
+	var listed []string
+	cursor := int64(0)
+	for page := 0; ; page++ {
+		infos, next, err := i.ListTasks(ctx, "emails", TaskStatePending, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range infos {
+			if info.Task == nil || info.Task.ID != info.ID {
+				t.Fatalf("info = %+v, want the task body", info)
+			}
+			listed = append(listed, info.ID)
+		}
+		if page < 2 && next != cursor+2 {
+			t.Fatalf("page %d next = %d, want %d", page, next, cursor+2)
+		}
+		if next == 0 {
+			if page != 2 || len(infos) != 1 {
+				t.Fatalf("last page = %d with %d tasks, want page 2 with 1 task", page, len(infos))
+			}
+			break
+		}
+		cursor = next
+	}
+	for idx, task := range tasks {
+		if listed[idx] != task.ID {
+			t.Fatalf("listed = %v, want dequeue order", listed)
+		}
+	}
+}
+
+// 延迟和重试任务带有下次执行时间，按执行时间排列
+func TestListTasksNextRunAt(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	runAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	delay := queue.NewDelayQueue("emails", engine, 0)
+	later := taskstruct.NewTask("send", nil, 3)
+	sooner := taskstruct.NewTask("send", nil, 3)
+	if err := delay.ScheduleTask(ctx, later, runAt.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := delay.ScheduleTask(ctx, sooner, runAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.NewRetryQueue("emails", engine, time.Minute, time.Hour, 3).EnqueueTask(ctx, taskstruct.NewTask("send", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	i := NewInspector(engine)
+
+	scheduled, next, err := i.ListTasks(ctx, "emails", TaskStateScheduled, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 0 || len(scheduled) != 2 || scheduled[0].ID != sooner.ID || !scheduled[0].NextRunAt.Equal(runAt) {
+		t.Fatalf("scheduled = %+v, next = %d, want %s first at %v", scheduled, next, sooner.ID, runAt)
+	}
+	retry, _, err := i.ListTasks(ctx, "emails", TaskStateRetry, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retry) != 1 || retry[0].NextRunAt.Before(time.Now().Add(30*time.Second)) {
+		t.Fatalf("retry = %+v, want one task with a backoff NextRunAt", retry)
+	}
+}
+
+// 就绪任务的列表包含租户子列表，分页可以跨越列表边界，总数与 Pending 一致
+func TestListPendingIncludesTenants(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := queue.NewQueue("emails", engine)
+	var want []string
+	for _, tenant := range []string{"", "", "acme", "acme", "globex"} {
+		task := taskstruct.NewTask("send", nil, 3)
+		task.Tenant = tenant
+		if err := q.EnqueueTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, task.ID)
+	}
+	i := NewInspector(engine)
+
+	var listed []string
+	for cursor := int64(0); ; {
+		infos, next, err := i.ListTasks(ctx, "emails", TaskStatePending, cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range infos {
+			listed = append(listed, info.ID)
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if len(listed) != len(want) {
+		t.Fatalf("listed %d tasks, want %d", len(listed), len(want))
+	}
+	for idx := range want {
+		if listed[idx] != want[idx] {
+			t.Fatalf("listed = %v, want plain tasks, then acme, then globex", listed)
+		}
+	}
+	stats, err := i.GetQueueStats(ctx, "emails")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pending != int64(len(listed)) {
+		t.Fatalf("pending = %d, listed = %d, want equal", stats.Pending, len(listed))
+	}
+}
@@ -0,0 +1,56 @@
+package inspector
+
+import (
+	"context"
+	"practice/scheduler"
+	"sort"
+	"strconv"
+)
+
+type SchedulerQueue struct {
+	Queue         string `json:"queue"`
+	Priority      int64  `json:"priority"`       // 配置的优先级，权重模式下为权重
+	CurrentWeight int64  `json:"current_weight"` // 权重模式下的当前权重
+}
+
+// GetSchedulerQueues 读取调度器保存在Redis中的队列配置和当前权重
+func (i *Inspector) GetSchedulerQueues(ctx context.Context, name string) ([]*SchedulerQueue, error) {
+	queues := make(map[string]*SchedulerQueue)
+	get := func(queueName string) *SchedulerQueue {
+		if _, ok := queues[queueName]; !ok {
+			queues[queueName] = &SchedulerQueue{Queue: queueName}
+		}
+		return queues[queueName]
+	}
+
+	config, err := i.redisEngine.HGetAll(ctx, scheduler.ConfigKey(name))
+	if err != nil {
+		return nil, err
+	}
+	for queueName, priorityStr := range config {
+		priority, err := strconv.ParseInt(priorityStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		get(queueName).Priority = priority
+	}
+
+	weights, err := i.redisEngine.HGetAll(ctx, scheduler.WeightKey(name))
+	if err != nil {
+		return nil, err
+	}
+	for queueName, weightStr := range weights {
+		weight, err := strconv.ParseInt(weightStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		get(queueName).CurrentWeight = weight
+	}
+
+	result := make([]*SchedulerQueue, 0, len(queues))
+	for _, q := range queues {
+		result = append(result, q)
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].Queue < result[b].Queue })
+	return result, nil
+}
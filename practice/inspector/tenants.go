@@ -0,0 +1,46 @@
+package inspector
+
+import (
+	"context"
+	"fmt"
+	"practice/queue"
+	"strconv"
+)
+
+// TenantInfo 队列中某租户的待处理任务数和权重
+type TenantInfo struct {
+	Tenant  string `json:"tenant"`
+	Pending int64  `json:"pending"`
+	Weight  int    `json:"weight"` // 每轮可以取出的任务数，未设置时为1
+}
+
+// Tenants 返回队列中有待处理任务的租户，按轮询顺序排列
+func (i *Inspector) Tenants(ctx context.Context, name string) ([]*TenantInfo, error) {
+	namespace := i.redisEngine.GetName()
+	tenants, err := i.redisEngine.LRange(ctx, queue.TenantsKey(namespace, name), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("读取租户失败: %w", err)
+	}
+	weights, err := i.redisEngine.HGetAll(ctx, queue.TenantWeightsKey(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("读取租户权重失败: %w", err)
+	}
+
+	infos := []*TenantInfo{}
+	for _, tenant := range tenants {
+		key := queue.QueueKey(queue.KindQueue, name)
+		if tenant != "" {
+			key = queue.TenantKey(namespace, name, tenant)
+		}
+		pending, err := i.redisEngine.LLen(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("读取租户 %s 任务数失败: %w", tenant, err)
+		}
+		info := &TenantInfo{Tenant: tenant, Pending: pending, Weight: 1}
+		if weight, err := strconv.Atoi(weights[tenant]); err == nil {
+			info.Weight = weight
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
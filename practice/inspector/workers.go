@@ -0,0 +1,163 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"practice/queue"
+	"practice/worker"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// claimLostScript 所属 worker 已过期时从活跃任务哈希中取走任务，worker 仍存活或任务已被取走时返回空
+var claimLostScript = redis.NewScript(`
+local data = redis.call("HGET", KEYS[1], ARGV[1])
+if not data then
+    return false
+end
+local active = cjson.decode(data)
+local expireAt = redis.call("ZSCORE", KEYS[2], active["worker_id"])
+if expireAt and tonumber(expireAt) >= tonumber(ARGV[2]) then
+    return false
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+return data
+`)
+
+// ActiveTaskInfo 正在处理的任务，Lost 表示所属 worker 已经没有心跳
+type ActiveTaskInfo struct {
+	*worker.ActiveTask
+	Lost bool `json:"lost"`
+}
+
+// Workers 返回心跳未过期的 worker，按启动时间排序
+func (i *Inspector) Workers(ctx context.Context) ([]*worker.WorkerInfo, error) {
+	ids, err := i.redisEngine.ZRangeByScore(ctx, i.redisEngine.GetWorkersKey(), strconv.FormatInt(time.Now().UnixMilli(), 10), "+inf", 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("读取 worker 列表失败: %w", err)
+	}
+	if len(ids) == 0 {
+		return []*worker.WorkerInfo{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for index, id := range ids {
+		keys[index] = i.redisEngine.GetWorkerKey(id)
+	}
+	values, err := i.redisEngine.MGet(ctx, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("读取 worker 信息失败: %w", err)
+	}
+
+	workers := []*worker.WorkerInfo{}
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			// 登记信息已过期但还没有从集合中移除
+			continue
+		}
+		info := &worker.WorkerInfo{}
+		if err := json.Unmarshal([]byte(data), info); err != nil {
+			return nil, fmt.Errorf("反序列化 worker 信息失败: %w", err)
+		}
+		workers = append(workers, info)
+	}
+	sort.Slice(workers, func(a, b int) bool {
+		return workers[a].StartedAt.Before(workers[b].StartedAt)
+	})
+	return workers, nil
+}
+
+// ActiveTasks 返回所有正在处理的任务，所属 worker 已消失的任务标记为 Lost
+func (i *Inspector) ActiveTasks(ctx context.Context) ([]*ActiveTaskInfo, error) {
+	workers, err := i.Workers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	alive := make(map[string]bool, len(workers))
+	for _, info := range workers {
+		alive[info.ID] = true
+	}
+
+	values, err := i.redisEngine.HGetAll(ctx, i.redisEngine.GetActiveKey())
+	if err != nil {
+		return nil, fmt.Errorf("读取正在处理的任务失败: %w", err)
+	}
+
+	infos := []*ActiveTaskInfo{}
+	for _, data := range values {
+		active := &worker.ActiveTask{}
+		if err := json.Unmarshal([]byte(data), active); err != nil {
+			return nil, fmt.Errorf("反序列化正在处理的任务失败: %w", err)
+		}
+		infos = append(infos, &ActiveTaskInfo{ActiveTask: active, Lost: !alive[active.WorkerID]})
+	}
+	sort.Slice(infos, func(a, b int) bool {
+		return infos[a].StartedAt.Before(infos[b].StartedAt)
+	})
+	return infos, nil
+}
+
+// LostTasks 返回所属 worker 已经没有心跳的任务
+func (i *Inspector) LostTasks(ctx context.Context) ([]*ActiveTaskInfo, error) {
+	infos, err := i.ActiveTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lost := []*ActiveTaskInfo{}
+	for _, info := range infos {
+		if info.Lost {
+			lost = append(lost, info)
+		}
+	}
+	return lost, nil
+}
+
+// RequeueLostTasks 把所属 worker 已经没有心跳的任务放回原队列，返回放回的任务数
+// 任务先从活跃任务哈希中取走再归还，多个调用方同时执行时每个任务只会被放回一次
+func (i *Inspector) RequeueLostTasks(ctx context.Context) (int, error) {
+	lost, err := i.LostTasks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	activeKey := i.redisEngine.GetActiveKey()
+	for _, info := range lost {
+		taskID := info.Task.ID
+		result, err := i.redisEngine.RunScript(ctx, claimLostScript, []string{activeKey, i.redisEngine.GetWorkersKey()}, taskID, time.Now().UnixMilli())
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return requeued, fmt.Errorf("取回任务 %s 失败: %w", taskID, err)
+		}
+
+		data := result.(string)
+		active := &worker.ActiveTask{}
+		if err := json.Unmarshal([]byte(data), active); err != nil {
+			return requeued, fmt.Errorf("反序列化正在处理的任务失败: %w", err)
+		}
+		if err := i.requeueActive(ctx, active); err != nil {
+			// 归还失败时放回活跃任务哈希，下次还能找回
+			if restoreErr := i.redisEngine.HSet(ctx, activeKey, taskID, data); restoreErr != nil {
+				return requeued, fmt.Errorf("归还任务 %s 失败: %w，且无法恢复活跃记录: %v", taskID, err, restoreErr)
+			}
+			return requeued, fmt.Errorf("归还任务 %s 失败: %w", taskID, err)
+		}
+		requeued++
+	}
+	return requeued, nil
+}
+
+// requeueActive 按任务来源的队列种类放回，优先级队列的任务放回优先级ZSet，其余由 Queue.RequeueTask 按租户和截止时间路由
+func (i *Inspector) requeueActive(ctx context.Context, active *worker.ActiveTask) error {
+	if active.Kind == queue.KindPriority {
+		return queue.NewPriorityQueue(active.Queue, i.redisEngine).RequeueTask(ctx, active.Task)
+	}
+	return queue.NewQueue(active.Queue, i.redisEngine).RequeueTask(ctx, active.Task)
+}
@@ -0,0 +1,71 @@
+package inspector
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"practice/worker"
+)
+
+func trackActive(t *testing.T, engine *redisengine.RedisEngine, workerID string, expireAt time.Time, task *taskstruct.Task) {
+	t.Helper()
+	ctx := context.Background()
+	if err := engine.ZAdd(ctx, engine.GetWorkersKey(), float64(expireAt.UnixMilli()), workerID); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetWithExpire(ctx, engine.GetWorkerKey(workerID), `{"id":"`+workerID+`"}`, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&worker.ActiveTask{WorkerID: workerID, Queue: task.Queue, Kind: queue.KindQueue, Task: task, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.HSet(ctx, engine.GetActiveKey(), task.ID, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequeueLostTasks(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	lost := taskstruct.NewTask("send", nil, 3)
+	lost.Queue = "emails"
+	running := taskstruct.NewTask("send", nil, 3)
+	running.Queue = "emails"
+	trackActive(t, engine, "dead", time.Now().Add(-time.Minute), lost)
+	trackActive(t, engine, "alive", time.Now().Add(time.Minute), running)
+
+	insp := NewInspector(engine)
+	requeued, err := insp.RequeueLostTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 1 {
+		t.Fatalf("requeued = %d, want 1", requeued)
+	}
+	// 再次执行不会重复归还
+	if requeued, err = insp.RequeueLostTasks(ctx); err != nil || requeued != 0 {
+		t.Fatalf("second RequeueLostTasks = %d, %v, want 0, nil", requeued, err)
+	}
+
+	task, err := queue.NewQueue("emails", engine).DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ID != lost.ID {
+		t.Fatalf("dequeued %s, want lost task %s", task.ID, lost.ID)
+	}
+	active, err := insp.ActiveTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].Task.ID != running.ID {
+		t.Fatalf("active tasks = %+v, want only the running task", active)
+	}
+}
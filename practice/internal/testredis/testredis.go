@@ -0,0 +1,23 @@
+// Package testredis 为各包的测试提供连接 miniredis 的 RedisEngine
+package testredis
+
+import (
+	"testing"
+
+	"practice/redisengine"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Namespace 测试用 RedisEngine 的名称
+const Namespace = "test"
+
+// New 启动一个 miniredis 并返回连接它的 RedisEngine，测试结束时自动关闭
+func New(t testing.TB) (*miniredis.Miniredis, *redisengine.RedisEngine) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, redisengine.NewRedisEngine(client, Namespace)
+}
@@ -0,0 +1,25 @@
+// 日志接口
+
+// 方法签名与 log/slog 一致，可以直接传入 *slog.Logger，默认不输出任何日志
+
+package logging
+
+import "log/slog"
+
+// Logger 分级的结构化日志，args 为交替的键值对，例如 "queue", "queue:default", "task_id", "1"
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var _ Logger = (*slog.Logger)(nil)
+
+// Nop 丢弃所有日志
+type Nop struct{}
+
+func (Nop) Debug(msg string, args ...any) {}
+func (Nop) Info(msg string, args ...any)  {}
+func (Nop) Warn(msg string, args ...any)  {}
+func (Nop) Error(msg string, args ...any) {}
@@ -0,0 +1,135 @@
+// Prometheus 指标
+
+// 计数器和直方图在进程内累计，队列大小在每次抓取时从Redis读取，以 Prometheus 文本格式输出
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"practice/inspector"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/scheduler"
+	"practice/worker"
+	"time"
+)
+
+const namespace = "redistrain"
+
+var (
+	_ queue.Recorder     = (*Metrics)(nil)
+	_ scheduler.Recorder = (*Metrics)(nil)
+
+	_ worker.ProcessingObserver = (*Metrics)(nil)
+)
+
+type Metrics struct {
+	inspector *inspector.Inspector
+
+	enqueued     *counterVec
+	processed    *counterVec
+	failed       *counterVec
+	retried      *counterVec
+	deadLettered *counterVec
+	selections   *counterVec
+
+	processingDuration *histogramVec
+	queueLatency       *histogramVec
+}
+
+// New 创建指标集合，通过 queue.WithRecorder 和 scheduler.WithRecorder 传给队列和调度器
+func New(redisEngine *redisengine.RedisEngine) *Metrics {
+	return &Metrics{
+		inspector: inspector.NewInspector(redisEngine),
+
+		enqueued:     newCounterVec(namespace+"_tasks_enqueued_total", "入队的任务数", "queue", "type"),
+		processed:    newCounterVec(namespace+"_tasks_processed_total", "处理成功的任务数", "queue", "type"),
+		failed:       newCounterVec(namespace+"_tasks_failed_total", "处理失败的任务数", "queue", "type"),
+		retried:      newCounterVec(namespace+"_tasks_retried_total", "进入重试队列的任务数", "queue", "type"),
+		deadLettered: newCounterVec(namespace+"_tasks_dead_lettered_total", "进入死信队列的任务数", "queue", "type"),
+		selections:   newCounterVec(namespace+"_scheduler_selections_total", "调度器选中各队列的次数", "scheduler", "queue"),
+
+		processingDuration: newHistogramVec(namespace+"_task_processing_duration_seconds", "任务处理耗时", defaultBuckets, "queue", "type"),
+		queueLatency:       newHistogramVec(namespace+"_task_queue_latency_seconds", "任务从就绪到出队的等待时间", defaultBuckets, "queue"),
+	}
+}
+
+func (m *Metrics) TaskEnqueued(queue, taskType string) {
+	m.enqueued.inc(queue, taskType)
+}
+
+func (m *Metrics) TaskDequeued(queue, taskType string, latency time.Duration) {
+	m.queueLatency.observe(latency.Seconds(), queue)
+}
+
+func (m *Metrics) TaskProcessed(queue, taskType string) {
+	m.processed.inc(queue, taskType)
+}
+
+func (m *Metrics) TaskFailed(queue, taskType string) {
+	m.failed.inc(queue, taskType)
+}
+
+func (m *Metrics) TaskRetried(queue, taskType string) {
+	m.retried.inc(queue, taskType)
+}
+
+func (m *Metrics) TaskDeadLettered(queue, taskType string) {
+	m.deadLettered.inc(queue, taskType)
+}
+
+// ObserveProcessing 记录一次任务处理耗时，由执行任务的一方调用
+func (m *Metrics) ObserveProcessing(queue, taskType string, duration time.Duration) {
+	m.processingDuration.observe(duration.Seconds(), queue, taskType)
+}
+
+func (m *Metrics) QueueSelected(scheduler, queue string) {
+	m.selections.inc(scheduler, queue)
+}
+
+// ServeHTTP 输出 Prometheus 文本格式的指标
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+
+	sizes, err := m.collectQueueSizes(r.Context())
+	scrapeError := 0.0
+	if err != nil {
+		scrapeError = 1
+	}
+	writeGauge(buf, namespace+"_queue_size", "各种类队列中的任务数", []string{"queue", "kind"}, sizes)
+	writeGauge(buf, namespace+"_scrape_error", "读取队列大小是否失败", nil, []gaugeSample{{value: scrapeError}})
+
+	for _, counter := range []*counterVec{m.enqueued, m.processed, m.failed, m.retried, m.deadLettered, m.selections} {
+		counter.write(buf)
+	}
+	m.processingDuration.write(buf)
+	m.queueLatency.write(buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (m *Metrics) collectQueueSizes(ctx context.Context) ([]gaugeSample, error) {
+	names, err := m.inspector.Queues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	samples := []gaugeSample{}
+	for _, name := range names {
+		stats, err := m.inspector.GetQueueStats(ctx, name)
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples,
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStatePending)}, value: float64(stats.Pending)},
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStateScheduled)}, value: float64(stats.Scheduled)},
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStateRetry)}, value: float64(stats.Retry)},
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStateDead)}, value: float64(stats.Dead)},
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStatePrioritized)}, value: float64(stats.Prioritized)},
+			gaugeSample{labelValues: []string{name, string(inspector.TaskStateDeadline)}, value: float64(stats.Deadline)},
+		)
+	}
+	return samples, nil
+}
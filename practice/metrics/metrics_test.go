@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// scrape 抓取一次指标，返回输出的所有行
+func scrape(t *testing.T, m *Metrics) []string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q, want Prometheus text format", contentType)
+	}
+	return strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+}
+
+// sampleValue 解析 "name{labels} value" 中的值
+func sampleValue(t *testing.T, line string) float64 {
+	t.Helper()
+	value, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64)
+	if err != nil {
+		t.Fatalf("parse %q: %v", line, err)
+	}
+	return value
+}
+
+func TestExpositionTypes(t *testing.T) {
+	_, engine := testredis.New(t)
+	if err := queue.NewQueue("emails", engine).EnqueueTask(context.Background(), taskstruct.NewTask("send", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	m := New(engine)
+	m.TaskEnqueued("emails", "send")
+
+	lines := scrape(t, m)
+	for _, want := range []string{
+		"# TYPE redistrain_queue_size gauge",
+		"# TYPE redistrain_tasks_enqueued_total counter",
+		"# TYPE redistrain_task_processing_duration_seconds histogram",
+		`redistrain_queue_size{queue="emails",kind="pending"} 1`,
+		`redistrain_tasks_enqueued_total{queue="emails",type="send"} 1`,
+		"redistrain_scrape_error 0",
+	} {
+		found := false
+		for _, line := range lines {
+			if line == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("missing line %q", want)
+		}
+	}
+}
+
+// 分桶计数是累加的，le="+Inf" 的分桶等于 _count，超过最大分桶的值只计入 +Inf
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	_, engine := testredis.New(t)
+	m := New(engine)
+	for _, duration := range []time.Duration{3 * time.Millisecond, 200 * time.Millisecond, 200 * time.Millisecond, 10 * time.Minute} {
+		m.ObserveProcessing("images", "resize", duration)
+	}
+
+	prefix := "redistrain_task_processing_duration_seconds"
+	var buckets []float64
+	var inf, count float64
+	for _, line := range scrape(t, m) {
+		switch {
+		case strings.HasPrefix(line, prefix+"_bucket") && strings.Contains(line, `le="+Inf"`):
+			inf = sampleValue(t, line)
+		case strings.HasPrefix(line, prefix+"_bucket"):
+			buckets = append(buckets, sampleValue(t, line))
+		case strings.HasPrefix(line, prefix+"_count"):
+			count = sampleValue(t, line)
+		}
+	}
+	if len(buckets) != len(defaultBuckets) {
+		t.Fatalf("buckets = %v, want %d finite buckets", buckets, len(defaultBuckets))
+	}
+	for idx := 1; idx < len(buckets); idx++ {
+		if buckets[idx] < buckets[idx-1] {
+			t.Fatalf("buckets = %v, want cumulative counts", buckets)
+		}
+	}
+	if buckets[0] != 1 || buckets[len(buckets)-1] != 3 {
+		t.Fatalf("buckets = %v, want 1 in the first and 3 in the last finite bucket", buckets)
+	}
+	if inf != 4 || count != 4 {
+		t.Fatalf("+Inf bucket = %v, count = %v, want both 4", inf, count)
+	}
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	_, engine := testredis.New(t)
+	m := New(engine)
+	m.TaskEnqueued("say \"hi\"\nnow", `back\slash`)
+
+	want := `redistrain_tasks_enqueued_total{queue="say \"hi\"\nnow",type="back\\slash"} 1`
+	for _, line := range scrape(t, m) {
+		if line == want {
+			return
+		}
+	}
+	t.Fatalf("missing escaped sample %q", want)
+}
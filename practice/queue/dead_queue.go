@@ -8,30 +8,26 @@ import (
 	"practice/taskstruct"
 
 	"practice/redisengine"
-
-	"github.com/redis/go-redis/v9"
 )
 
 type DeadQueue struct {
-	name          string
-	redisEngine   *redisengine.RedisEngine
-	queue_type    string
-	enqueueScript *redis.Script
-	dequeueScript *redis.Script
+	Queue
 }
 
-func NewDeadQueue(name string, redisEngine *redisengine.RedisEngine) *DeadQueue {
-	return &DeadQueue{
+func NewDeadQueue(name string, redisEngine *redisengine.RedisEngine, opts ...Option) *DeadQueue {
+	queue := Queue{
 		name:          name,
 		redisEngine:   redisEngine,
-		queue_type:    "dead_queue",
+		queue_type:    KindDead,
 		enqueueScript: enqueueScript,
 		dequeueScript: dequeueScript,
+		requeueScript: requeueScript,
 	}
-}
+	queue.applyOptions(opts)
 
-func (q *DeadQueue) GetQueueKey() string {
-	return fmt.Sprintf("%s:%s", q.queue_type, q.name)
+	return &DeadQueue{
+		Queue: queue,
+	}
 }
 
 func (q *DeadQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) error {
@@ -46,43 +42,16 @@ func (q *DeadQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) erro
 		return fmt.Errorf("序列化任务失败: %w", err)
 	}
 
-	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey}, taskKey, taskData, task.ID)
+	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey, q.redisEngine.GetQueuesKey()}, taskKey, taskData, task.ID)
 	if err != nil {
 		return fmt.Errorf("任务入队失败: %w", err)
 	}
 
 	if result.(int64) == 0 {
-		fmt.Println("任务入队失败，任务已存在: ", task.ID)
-		return nil
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
 	}
 
+	q.logger.Warn("task moved to dead queue", "queue", queueKey, "task_id", task.ID, "type", task.Type, "attempt", task.Retry)
+	q.recorder.TaskDeadLettered(q.name, task.Type)
 	return nil
 }
-
-func (q *DeadQueue) DequeueTask(ctx context.Context) (*taskstruct.Task, error) {
-	taskID, err := q.redisEngine.RPop(ctx, q.GetQueueKey())
-	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有就绪任务\n", q.GetQueueKey())
-			return nil, nil
-		}
-		return nil, err
-	}
-	task := taskstruct.Task{ID: taskID}
-
-	taskKey := task.GetTaskKey()
-
-	taskData, err := q.redisEngine.RunScript(ctx, q.dequeueScript, []string{q.redisEngine.GetName(), q.GetQueueKey()}, taskKey)
-	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有找到任务\n", taskKey)
-			return nil, nil
-		}
-		return nil, err
-	}
-
-	if err := json.Unmarshal([]byte(taskData.(string)), &task); err != nil {
-		return nil, err
-	}
-	return &task, nil
-}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+// 直接消费普通队列时带截止时间的任务仍按入队顺序出队，出队后从截止时间ZSet中移除
+func TestDeadlineKeepsFIFO(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := NewQueue("emails", engine)
+
+	plain := taskstruct.NewTask("send", nil, 3)
+	late := taskstruct.NewTask("send", nil, 3)
+	late.Deadline = time.Now().Add(time.Hour)
+	soon := taskstruct.NewTask("send", nil, 3)
+	soon.Deadline = time.Now().Add(time.Minute)
+	for _, task := range []*taskstruct.Task{plain, late, soon} {
+		if err := q.EnqueueTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []*taskstruct.Task{plain, late, soon} {
+		got, err := q.DequeueTask(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("dequeued %s, want %s", got.ID, want.ID)
+		}
+	}
+	if size, err := engine.ZCard(ctx, q.GetDeadlineKey()); err != nil || size != 0 {
+		t.Fatalf("deadline index size = %d (%v), want 0", size, err)
+	}
+}
+
+// 延迟任务到期后按租户和截止时间放回普通队列
+func TestForwardScheduledKeepsRoute(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	delay := NewDelayQueue("emails", engine, 0)
+
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Tenant = "acme"
+	task.Deadline = time.Now().Add(time.Hour)
+	if err := delay.ScheduleTask(ctx, task, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := ForwardScheduled(ctx, engine, "emails", time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 1 {
+		t.Fatalf("moved = %d, want 1", moved)
+	}
+	ids, err := engine.LRange(ctx, TenantKey(engine.GetName(), "emails", "acme"), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != task.ID {
+		t.Fatalf("tenant list = %v, want [%s]", ids, task.ID)
+	}
+	members, err := engine.ZRangeWithScores(ctx, QueueKey(KindDeadline, "emails"), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || int64(members[0].Score) != task.Deadline.UnixMilli() {
+		t.Fatalf("deadline index = %v, want %s at its deadline", members, task.ID)
+	}
+	if tenants, err := NewQueue("emails", engine).Tenants(ctx); err != nil || len(tenants) != 1 {
+		t.Fatalf("tenants = %v (%v), want [acme]", tenants, err)
+	}
+}
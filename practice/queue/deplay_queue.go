@@ -6,10 +6,9 @@ import (
 	"fmt"
 	"practice/redisengine"
 	"practice/taskstruct"
+	"practice/tracing"
 	"sync"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 type DelayQueue struct {
@@ -18,14 +17,16 @@ type DelayQueue struct {
 	mutex         *sync.Mutex
 }
 
-func NewDelayQueue(name string, redisEngine *redisengine.RedisEngine, delayDuration time.Duration) *DelayQueue {
+func NewDelayQueue(name string, redisEngine *redisengine.RedisEngine, delayDuration time.Duration, opts ...Option) *DelayQueue {
 	queue := Queue{
 		name:          name,
 		redisEngine:   redisEngine,
-		queue_type:    "delay_queue",
+		queue_type:    KindDelay,
 		enqueueScript: delayEnqueueScript,
-		dequeueScript: dequeueScript,
+		dequeueScript: delayDequeueScript,
+		requeueScript: delayRequeueScript,
 	}
+	queue.applyOptions(opts)
 
 	return &DelayQueue{
 		Queue:         queue,
@@ -39,23 +40,46 @@ func (q *DelayQueue) getQueueKey() string {
 }
 
 func (q *DelayQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) error {
+	_, span := tracing.StartEnqueueSpan(ctx, q.tracer, q.name, task)
+	defer span.End()
+
+	if err := q.enqueueAt(ctx, task, task.Created.Add(q.DelayDuration)); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	q.recorder.TaskEnqueued(q.name, task.Type)
+	return nil
+}
+
+// ScheduleTask 把已出队的任务放回本队列，在 readyAt 之后再执行，不计入入队数和重试次数
+func (q *DelayQueue) ScheduleTask(ctx context.Context, task *taskstruct.Task, readyAt time.Time) error {
+	task.Status = taskstruct.TaskStatusPending
+	if err := q.enqueueAt(ctx, task, readyAt); err != nil {
+		return err
+	}
+	q.logger.Debug("task scheduled", "queue", q.getQueueKey(), "task_id", task.ID, "type", task.Type, "ready_at", readyAt)
+	return nil
+}
+
+func (q *DelayQueue) enqueueAt(ctx context.Context, task *taskstruct.Task, readyAt time.Time) error {
+
 	taskKey := task.GetTaskKey()
 	queueKey := q.getQueueKey()
 
+	task.ReadyAt = readyAt.UnixMilli()
 	taskData, err := json.Marshal(task)
 	if err != nil {
 		return fmt.Errorf("序列化任务失败: %w", err)
 	}
-	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey}, taskKey, taskData, task.Created.Add(q.DelayDuration).UnixMilli(), task.ID)
+	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey, q.redisEngine.GetQueuesKey()}, taskKey, taskData, readyAt.UnixMilli(), task.ID)
 	if err != nil {
 		return fmt.Errorf("任务入队失败: %w", err)
 	}
 
 	if result.(int64) == 0 {
-		fmt.Println("任务入队失败，任务已存在: ", task.ID)
-		return nil
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
 	}
-
 	return nil
 }
 
@@ -63,35 +87,13 @@ func (q *DelayQueue) DequeueTask(ctx context.Context) (*taskstruct.Task, error)
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	currentTime := time.Now().UnixMilli()
-	taskID, err := q.redisEngine.ZRangeByScore(ctx, q.getQueueKey(), "-inf", fmt.Sprintf("%d", currentTime), 0, 1)
+	paused, err := q.isPaused(ctx)
 	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有就绪任务\n", q.getQueueKey())
-			return nil, nil
-		}
-		return nil, fmt.Errorf("延迟队列出队失败: %w", err)
-	}
-	if len(taskID) == 0 {
-		fmt.Printf("%s 没有就绪任务\n", q.getQueueKey())
-		return nil, nil
-	}
-
-	task := taskstruct.Task{ID: taskID[0]}
-
-	taskKey := task.GetTaskKey()
-
-	taskData, err := q.redisEngine.RunScript(ctx, q.dequeueScript, []string{q.redisEngine.GetName()}, taskKey)
-	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有找到任务\n", taskKey)
-			return nil, nil
-		}
 		return nil, err
 	}
-
-	if err := json.Unmarshal([]byte(taskData.(string)), &task); err != nil {
-		return nil, err
+	if paused {
+		return nil, ErrQueueEmpty
 	}
-	return &task, nil
+
+	return q.popTask(ctx, time.Now().UnixMilli())
 }
@@ -0,0 +1,14 @@
+package queue
+
+import "errors"
+
+var (
+	// ErrQueueEmpty 队列中没有就绪任务，或队列已暂停
+	ErrQueueEmpty = errors.New("队列为空")
+	// ErrDuplicateTask 相同ID的任务已经存在
+	ErrDuplicateTask = errors.New("任务已存在")
+	// ErrTaskNotFound 任务体不存在，出队时遇到说明任务ID成了孤儿
+	ErrTaskNotFound = errors.New("任务不存在")
+	// ErrGroupChanged 准备合并的任务已不在分组中，可能已被取消或被其他聚合器合并
+	ErrGroupChanged = errors.New("分组已变化")
+)
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"strconv"
+	"time"
+)
+
+// ForwardScheduled 把同名延迟队列和重试队列中到期的任务移到普通队列，返回移动的任务数
+// 消费普通队列的 worker 依赖它取到延迟和重试的任务，每种队列一次最多移动 batch 个
+// 任务按 Tenant、Deadline 放回租户子列表和截止时间ZSet，与直接入队时相同
+func ForwardScheduled(ctx context.Context, redisEngine *redisengine.RedisEngine, name string, now time.Time, batch int) (int, error) {
+	total := 0
+	for _, kind := range []string{KindDelay, KindRetry} {
+		sourceKey := QueueKey(kind, name)
+		taskIDs, err := redisEngine.ZRangeByScore(ctx, sourceKey, "-inf", strconv.FormatInt(now.UnixMilli(), 10), 0, int64(batch))
+		if err != nil {
+			return total, fmt.Errorf("读取到期任务失败: %w", err)
+		}
+		if len(taskIDs) == 0 {
+			continue
+		}
+		tasks, err := readTasks(ctx, redisEngine, taskIDs)
+		if err != nil {
+			return total, err
+		}
+
+		keys := []string{sourceKey}
+		args := make([]interface{}, 0, len(tasks)*3)
+		for _, task := range tasks {
+			tenant, deadline := ReadyRoute(task)
+			keys = append(keys, ReadyKeys(redisEngine, name, tenant)...)
+			args = append(args, task.ID, tenant, deadline)
+		}
+		result, err := redisEngine.RunScript(ctx, forwardScript, keys, args...)
+		if err != nil {
+			return total, fmt.Errorf("转移到期任务失败: %w", err)
+		}
+		total += int(result.(int64))
+	}
+	return total, nil
+}
+
+// readTasks 读取任务体，任务体丢失的任务只有ID，没有路由信息，会被放入普通列表
+func readTasks(ctx context.Context, redisEngine *redisengine.RedisEngine, taskIDs []string) ([]*taskstruct.Task, error) {
+	taskKeys := make([]string, 0, len(taskIDs))
+	for _, taskID := range taskIDs {
+		taskKeys = append(taskKeys, (&taskstruct.Task{ID: taskID}).GetTaskKey())
+	}
+	values, err := redisEngine.HMGet(ctx, redisEngine.GetName(), taskKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务失败: %w", err)
+	}
+
+	tasks := make([]*taskstruct.Task, 0, len(taskIDs))
+	for idx, taskID := range taskIDs {
+		task := &taskstruct.Task{}
+		if taskData, ok := values[idx].(string); ok {
+			if err := json.Unmarshal([]byte(taskData), task); err != nil {
+				return nil, fmt.Errorf("反序列化任务失败: %w", err)
+			}
+		}
+		task.ID = taskID
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// ForwardScheduledPriority 把同名延迟队列和重试队列中到期的任务按 Task.Priority 移到优先级队列，返回移动的任务数
+// 消费优先级队列的 worker 依赖它取到被推迟和重试的任务，每种队列一次最多移动 batch 个
+func ForwardScheduledPriority(ctx context.Context, redisEngine *redisengine.RedisEngine, name string, now time.Time, batch int) (int, error) {
+	priorityKey := QueueKey(KindPriority, name)
+	total := 0
+	for _, kind := range []string{KindDelay, KindRetry} {
+		keys := []string{QueueKey(kind, name), priorityKey, priorityKey + ":seq", redisEngine.GetName(), redisEngine.GetQueuesKey()}
+		result, err := redisEngine.RunScript(ctx, forwardPriorityScript, keys, now.UnixMilli(), batch, taskstruct.TaskKeyPrefix, prioritySpan)
+		if err != nil {
+			return total, fmt.Errorf("转移到期任务失败: %w", err)
+		}
+		total += int(result.(int64))
+	}
+	return total, nil
+}
@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GroupKey 某队列某分组中等待聚合的任务，分数为入队时间(毫秒)
+func GroupKey(namespace, name, group string) string {
+	return fmt.Sprintf("%s:group:%s:%s", namespace, name, group)
+}
+
+// GroupsKey 某队列中有待聚合任务的分组名称集合
+func GroupsKey(namespace, name string) string {
+	return fmt.Sprintf("%s:groups:%s", namespace, name)
+}
+
+func (q *Queue) enqueueGroup(ctx context.Context, task *taskstruct.Task) error {
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	namespace := q.redisEngine.GetName()
+	keys := []string{namespace, GroupKey(namespace, q.name, task.Group), GroupsKey(namespace, q.name)}
+	result, err := q.redisEngine.RunScript(ctx, groupEnqueueScript, keys, task.GetTaskKey(), taskData, time.Now().UnixMilli(), task.ID, task.Group)
+	if err != nil {
+		return fmt.Errorf("任务入组失败: %w", err)
+	}
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+	return nil
+}
+
+// Groups 返回有待聚合任务的分组名称
+func (q *Queue) Groups(ctx context.Context) ([]string, error) {
+	groups, err := q.redisEngine.SMembers(ctx, GroupsKey(q.redisEngine.GetName(), q.name))
+	if err != nil {
+		return nil, fmt.Errorf("读取分组失败: %w", err)
+	}
+	return groups, nil
+}
+
+// ReadyGroup 分组满足任一聚合条件时返回其中最早的至多 maxSize 个任务，不满足时返回空
+// 条件为: 任务数达到 maxSize、最近一个任务入组后超过 gracePeriod、最早一个任务入组后超过 maxDelay，为0的条件不生效
+// 任务仍留在分组中，合并后通过 CommitGroup 移除
+func (q *Queue) ReadyGroup(ctx context.Context, group string, gracePeriod, maxDelay time.Duration, maxSize int) ([]*taskstruct.Task, error) {
+	namespace := q.redisEngine.GetName()
+	keys := []string{namespace, GroupKey(namespace, q.name, group), GroupsKey(namespace, q.name)}
+	result, err := q.redisEngine.RunScript(ctx, readyGroupScript, keys, taskstruct.TaskKeyPrefix, time.Now().UnixMilli(), gracePeriod.Milliseconds(), maxDelay.Milliseconds(), maxSize, group)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取分组任务失败: %w", err)
+	}
+
+	tasks := []*taskstruct.Task{}
+	for _, value := range result.([]interface{}) {
+		task := &taskstruct.Task{}
+		if err := json.Unmarshal([]byte(value.(string)), task); err != nil {
+			return nil, fmt.Errorf("反序列化任务失败: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// CommitGroup 原子地从分组中移除 tasks 并把合并后的任务 combined 放入就绪状态
+// tasks 中有任务已不在分组中时什么都不做，返回 ErrGroupChanged
+func (q *Queue) CommitGroup(ctx context.Context, group string, tasks []*taskstruct.Task, combined *taskstruct.Task) error {
+	// 合并后的任务直接进入就绪状态，不再分组
+	combined.Group = ""
+	combined.Status = taskstruct.TaskStatusPending
+	combined.ReadyAt = time.Now().UnixMilli()
+	taskData, err := json.Marshal(combined)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	namespace := q.redisEngine.GetName()
+	tenant, deadline := ReadyRoute(combined)
+	keys := append([]string{namespace, GroupKey(namespace, q.name, group), GroupsKey(namespace, q.name)}, ReadyKeys(q.redisEngine, q.name, tenant)...)
+	args := []interface{}{taskstruct.TaskKeyPrefix, group, combined.GetTaskKey(), taskData, combined.ID, tenant, deadline}
+	for _, task := range tasks {
+		args = append(args, task.ID)
+	}
+	result, err := q.redisEngine.RunScript(ctx, commitGroupScript, keys, args...)
+	if err != nil {
+		return fmt.Errorf("合并任务入队失败: %w", err)
+	}
+	switch result.(int64) {
+	case 0:
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, combined.ID)
+	case -1:
+		return fmt.Errorf("%w: %s", ErrGroupChanged, group)
+	}
+	// 被合并的任务在进入分组时已计入入队数，合并后的任务不再计入
+	return nil
+}
@@ -9,20 +9,61 @@ if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
 end
 redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
 redis.call("LPUSH", KEYS[2], ARGV[3])
+redis.call("SADD", KEYS[3], KEYS[2])
 
 return 1
 `)
 
-var dequeueScript = redis.NewScript(`
-if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+// dequeueScript 原子性地从列表右端弹出任务ID并取出任务体
+// 普通队列额外传入 截止时间ZSet、租户环、租户赤字、租户权重 作为 KEYS[3..6]，队列名作为 ARGV[2]，
+// 按赤字轮询在租户之间轮转，没有租户的任务作为租户 "" 参与轮询，租户任务不会因为列表中一直有任务而饿死
+// 带截止时间的任务同样按入队顺序出队，出队后从截止时间ZSet中移除
+// 返回 {任务ID, 0, 任务体}，任务体丢失时只返回 {任务ID, 0}，队列为空返回nil
+var dequeueScript = redis.NewScript(PopTenantLua + `
+local taskID
+if KEYS[4] then
+    taskID = popTenant(KEYS[1], ARGV[2], KEYS[2], KEYS[4], KEYS[5], KEYS[6], true)
+else
+    taskID = redis.call("RPOP", KEYS[2])
+end
+if not taskID then
+    return nil
+end
+if KEYS[3] then
+    redis.call("ZREM", KEYS[3], taskID)
+end
+
+local taskKey = ARGV[1] .. taskID
+local taskData = redis.call("HGET", KEYS[1], taskKey)
+if not taskData then
+    return {taskID, "0"}
+end
+
+redis.call("HDEL", KEYS[1], taskKey)
+
+return {taskID, "0", taskData}
+`)
+
+// delayDequeueScript 原子性地从ZSet取出一个已到期的任务ID并取出任务体
+// 返回 {任务ID, 到期时间, 任务体}，任务体丢失时只返回 {任务ID, 到期时间}，没有到期任务返回nil
+var delayDequeueScript = redis.NewScript(`
+local members = redis.call("ZRANGEBYSCORE", KEYS[2], "-inf", ARGV[2], "WITHSCORES", "LIMIT", 0, 1)
+if #members == 0 then
     return nil
 end
 
-local taskData = redis.call("HGET", KEYS[1], ARGV[1])
+local taskID = members[1]
+redis.call("ZREM", KEYS[2], taskID)
+
+local taskKey = ARGV[1] .. taskID
+local taskData = redis.call("HGET", KEYS[1], taskKey)
+if not taskData then
+    return {taskID, members[2]}
+end
 
-redis.call("HDEL", KEYS[1], ARGV[1])
+redis.call("HDEL", KEYS[1], taskKey)
 
-return taskData
+return {taskID, members[2], taskData}
 `)
 
 var delayEnqueueScript = redis.NewScript(`
@@ -32,6 +73,232 @@ end
 
 redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
 redis.call("ZADD", KEYS[2], ARGV[3], ARGV[4])
+redis.call("SADD", KEYS[3], KEYS[2])
+
+return 1
+`)
+
+// PushReadyLua 定义 Lua 函数 pushReady，拼接在需要把任务ID放入就绪状态的脚本之前使用
+// pushReady(offset, taskID, tenant, deadline, front) 使用 KEYS[offset+1..offset+6]，依次为 ReadyKeys 返回的
+// 普通列表、租户子列表、截止时间ZSet、租户环、唤醒列表、队列注册集合
+// 与 Queue.EnqueueTask 的路由相同: 有租户时放入租户子列表，否则放入普通列表；
+// 有截止时间(毫秒，0表示没有)时再记入截止时间ZSet，供最早截止时间优先调度使用
+// 之后在唤醒列表中留下一个信号(至多保留一个)，唤醒阻塞等待的调度器
+// front 为 true 时放在出队端，tenant、deadline 由 ReadyRoute 计算
+const PushReadyLua = `
+local function pushReady(offset, taskID, tenant, deadline, front)
+    local listKey, tenantKey, deadlineKey = KEYS[offset + 1], KEYS[offset + 2], KEYS[offset + 3]
+    local ringKey, notifyKey, registryKey = KEYS[offset + 4], KEYS[offset + 5], KEYS[offset + 6]
+    local key = listKey
+    if tenant ~= "" then
+        key = tenantKey
+    end
+    local length
+    if front then
+        length = redis.call("RPUSH", key, taskID)
+    else
+        length = redis.call("LPUSH", key, taskID)
+    end
+    if tenant ~= "" and length == 1 then
+        redis.call("RPUSH", ringKey, tenant)
+    end
+    if tonumber(deadline) > 0 then
+        redis.call("ZADD", deadlineKey, deadline, taskID)
+    end
+    redis.call("SADD", registryKey, listKey)
+    redis.call("LPUSH", notifyKey, 1)
+    redis.call("LTRIM", notifyKey, 0, 0)
+end
+`
+
+// readyEnqueueScript 保存任务体并用 pushReady 把任务放入普通队列，任务已存在时返回0
+// KEYS[1] 为任务Hash，之后为 ReadyKeys 返回的key
+// ARGV 依次为 任务key、任务体、任务ID、租户、截止时间、是否放在出队端(1为是)
+var readyEnqueueScript = redis.NewScript(PushReadyLua + `
+if redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+    return 0
+end
+pushReady(1, ARGV[3], ARGV[4], ARGV[5], ARGV[6] == "1")
+
+return 1
+`)
+
+// requeueScript 把未处理完的任务放回列表右端，下次出队时最先取出
+var requeueScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+    return 0
+end
+redis.call("RPUSH", KEYS[2], ARGV[3])
+redis.call("SADD", KEYS[3], KEYS[2])
+
+return 1
+`)
+
+// delayRequeueScript 把未处理完的任务放回ZSet，到期时间为 ARGV[4]
+var delayRequeueScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+    return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[3])
+redis.call("SADD", KEYS[3], KEYS[2])
+
+return 1
+`)
+
+// forwardScript 把ZSet中仍在的到期任务ID用 pushReady 移到普通队列，任务体不动
+// KEYS[1] 为来源ZSet，之后每个任务为 ReadyKeys 返回的6个key
+// ARGV 每个任务为 任务ID、租户、截止时间，返回移动的任务数
+var forwardScript = redis.NewScript(PushReadyLua + `
+local moved = 0
+for i = 1, #ARGV, 3 do
+    if redis.call("ZREM", KEYS[1], ARGV[i]) == 1 then
+        pushReady(1 + (i - 1) / 3 * 6, ARGV[i], ARGV[i + 1], ARGV[i + 2], false)
+        moved = moved + 1
+    end
+end
+
+return moved
+`)
+
+// groupEnqueueScript 把任务放入分组ZSet等待聚合，分数为入队时间
+var groupEnqueueScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+    return 0
+end
+
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[4])
+redis.call("SADD", KEYS[3], ARGV[5])
 
 return 1
 `)
+
+// forwardPriorityScript 把ZSet中已到期的任务ID按任务体中的优先级移到优先级队列，一次最多移动 ARGV[2] 个
+// KEYS 依次为 来源ZSet、优先级ZSet、序号计数器、任务Hash、队列注册集合
+// ARGV 依次为 当前时间、最大个数、任务key前缀、优先级跨度，分数的计算与 priorityEnqueueScript 相同
+var forwardPriorityScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, id in ipairs(ids) do
+    redis.call("ZREM", KEYS[1], id)
+    local priority = 0
+    local taskData = redis.call("HGET", KEYS[4], ARGV[3] .. id)
+    if taskData then
+        priority = tonumber(cjson.decode(taskData)["priority"] or 0)
+    end
+    if redis.call("ZCARD", KEYS[2]) == 0 then
+        redis.call("DEL", KEYS[3])
+    end
+    local seq = redis.call("INCR", KEYS[3])
+    redis.call("ZADD", KEYS[2], priority * tonumber(ARGV[4]) - seq, id)
+end
+if #ids > 0 then
+    redis.call("SADD", KEYS[5], KEYS[2])
+end
+
+return #ids
+`)
+
+// readyGroupScript 分组满足聚合条件时返回最早的至多 ARGV[5] 个任务体，不满足时返回nil
+// 只读取不取出，任务由 commitGroupScript 在合并任务入队时一起移除
+// ARGV 依次为 任务key前缀、当前时间、静默期、最长等待、最大个数、分组名，时间单位毫秒，0表示不限制
+var readyGroupScript = redis.NewScript(`
+local size = redis.call("ZCARD", KEYS[2])
+if size == 0 then
+    redis.call("SREM", KEYS[3], ARGV[6])
+    return nil
+end
+
+local now = tonumber(ARGV[2])
+local gracePeriod = tonumber(ARGV[3])
+local maxDelay = tonumber(ARGV[4])
+local maxSize = tonumber(ARGV[5])
+local oldest = tonumber(redis.call("ZRANGE", KEYS[2], 0, 0, "WITHSCORES")[2])
+local newest = tonumber(redis.call("ZRANGE", KEYS[2], -1, -1, "WITHSCORES")[2])
+
+local ready = (maxSize > 0 and size >= maxSize)
+    or (gracePeriod > 0 and now - newest >= gracePeriod)
+    or (maxDelay > 0 and now - oldest >= maxDelay)
+if not ready then
+    return nil
+end
+
+local ids = redis.call("ZRANGE", KEYS[2], 0, maxSize - 1)
+local bodies = {}
+for _, id in ipairs(ids) do
+    local taskData = redis.call("HGET", KEYS[1], ARGV[1] .. id)
+    if taskData then
+        table.insert(bodies, taskData)
+    else
+        -- 任务体已丢失的ID不再参与聚合
+        redis.call("ZREM", KEYS[2], id)
+    end
+end
+
+return bodies
+`)
+
+// commitGroupScript 从分组中移除已合并的任务并把合并后的任务放入就绪状态，两步在同一个脚本中完成
+// KEYS 依次为 任务Hash、分组ZSet、分组集合，之后为合并任务的 ReadyKeys
+// ARGV 依次为 任务key前缀、分组名、合并任务key、合并任务体、合并任务ID、租户、截止时间，之后为被合并的任务ID
+// 返回1表示成功，0表示合并任务ID已存在，-1表示被合并的任务已不在分组中(已被取消或被其他聚合器合并)
+var commitGroupScript = redis.NewScript(PushReadyLua + `
+for i = 8, #ARGV do
+    if not redis.call("ZSCORE", KEYS[2], ARGV[i]) then
+        return -1
+    end
+end
+if redis.call("HEXISTS", KEYS[1], ARGV[3]) == 1 and not redis.call("ZSCORE", KEYS[2], ARGV[5]) then
+    return 0
+end
+
+for i = 8, #ARGV do
+    redis.call("ZREM", KEYS[2], ARGV[i])
+    redis.call("HDEL", KEYS[1], ARGV[1] .. ARGV[i])
+end
+if redis.call("ZCARD", KEYS[2]) == 0 then
+    redis.call("SREM", KEYS[3], ARGV[2])
+end
+
+redis.call("HSET", KEYS[1], ARGV[3], ARGV[4])
+pushReady(3, ARGV[5], ARGV[6], ARGV[7], false)
+
+return 1
+`)
+
+// priorityEnqueueScript 按 优先级*ARGV[5] - 序号 计算分数放入ZSet，同优先级先入队的分数更大
+// 队列为空时序号从头开始，KEYS[4] 为序号计数器
+var priorityEnqueueScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+    return 0
+end
+
+if redis.call("ZCARD", KEYS[2]) == 0 then
+    redis.call("DEL", KEYS[4])
+end
+local seq = redis.call("INCR", KEYS[4])
+
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZADD", KEYS[2], tonumber(ARGV[4]) * tonumber(ARGV[5]) - seq, ARGV[3])
+redis.call("SADD", KEYS[3], KEYS[2])
+
+return 1
+`)
+
+// priorityDequeueScript 原子性地弹出分数最大的任务ID并取出任务体，返回格式同 dequeueScript
+var priorityDequeueScript = redis.NewScript(`
+local popped = redis.call("ZPOPMAX", KEYS[2])
+if #popped == 0 then
+    return nil
+end
+
+local taskID = popped[1]
+local taskKey = ARGV[1] .. taskID
+local taskData = redis.call("HGET", KEYS[1], taskKey)
+if not taskData then
+    return {taskID, "0"}
+end
+
+redis.call("HDEL", KEYS[1], taskKey)
+
+return {taskID, "0", taskData}
+`)
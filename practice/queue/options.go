@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"practice/logging"
+	"practice/tracing"
+	"time"
+)
+
+// Recorder 接收队列事件，用于统计指标，metrics.Metrics 实现了该接口
+type Recorder interface {
+	TaskEnqueued(queue, taskType string)
+	TaskDequeued(queue, taskType string, latency time.Duration)
+	TaskProcessed(queue, taskType string)
+	TaskFailed(queue, taskType string)
+	TaskRetried(queue, taskType string)
+	TaskDeadLettered(queue, taskType string)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) TaskEnqueued(queue, taskType string)                        {}
+func (nopRecorder) TaskDequeued(queue, taskType string, latency time.Duration) {}
+func (nopRecorder) TaskProcessed(queue, taskType string)                       {}
+func (nopRecorder) TaskFailed(queue, taskType string)                          {}
+func (nopRecorder) TaskRetried(queue, taskType string)                         {}
+func (nopRecorder) TaskDeadLettered(queue, taskType string)                    {}
+
+// Option 队列的可选配置，在构造函数中传入
+type Option func(*Queue)
+
+func WithRecorder(recorder Recorder) Option {
+	return func(q *Queue) {
+		q.recorder = recorder
+	}
+}
+
+// WithTracer 在入队和出队时创建span，并通过任务元数据传递链路
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(q *Queue) {
+		q.tracer = tracer
+	}
+}
+
+// WithLogger 设置日志，默认不输出
+func WithLogger(logger logging.Logger) Option {
+	return func(q *Queue) {
+		q.logger = logger
+	}
+}
+
+func (q *Queue) applyOptions(opts []Option) {
+	q.logger = logging.Nop{}
+	q.recorder = nopRecorder{}
+	q.tracer = tracing.NopTracer{}
+	for _, opt := range opts {
+		opt(q)
+	}
+}
@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"practice/tracing"
+	"time"
+)
+
+// 优先级的取值范围，分数为 优先级*prioritySpan-序号，需要在 float64 的精度内
+const (
+	MinPriority = -(1 << 20)
+	MaxPriority = 1<<20 - 1
+
+	prioritySpan = 1 << 32
+)
+
+// PriorityQueue 基于ZSet的优先级队列，按 Task.Priority 从高到低出队，同优先级先进先出
+type PriorityQueue struct {
+	Queue
+}
+
+func NewPriorityQueue(name string, redisEngine *redisengine.RedisEngine, opts ...Option) *PriorityQueue {
+	queue := Queue{
+		name:          name,
+		redisEngine:   redisEngine,
+		queue_type:    KindPriority,
+		enqueueScript: priorityEnqueueScript,
+		dequeueScript: priorityDequeueScript,
+		requeueScript: delayRequeueScript,
+	}
+	queue.applyOptions(opts)
+
+	return &PriorityQueue{
+		Queue: queue,
+	}
+}
+
+// 入队序号计数器
+func (q *PriorityQueue) getSeqKey() string {
+	return q.GetQueueKey() + ":seq"
+}
+
+func checkPriority(priority int) error {
+	if priority < MinPriority || priority > MaxPriority {
+		return fmt.Errorf("优先级 %d 超出范围 [%d, %d]", priority, MinPriority, MaxPriority)
+	}
+	return nil
+}
+
+func (q *PriorityQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) error {
+	_, span := tracing.StartEnqueueSpan(ctx, q.tracer, q.name, task)
+	defer span.End()
+
+	if err := checkPriority(task.Priority); err != nil {
+		return err
+	}
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	keys := []string{q.redisEngine.GetName(), q.GetQueueKey(), q.redisEngine.GetQueuesKey(), q.getSeqKey()}
+	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, keys, task.GetTaskKey(), taskData, task.ID, task.Priority, prioritySpan)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("任务入队失败: %w", err)
+	}
+
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+
+	q.recorder.TaskEnqueued(q.name, task.Type)
+	return nil
+}
+
+// ReturnTask 把已出队但暂时不能执行的任务放回本队列，排在同优先级任务的最后面
+// 不计入入队数，用于 worker 等待资源时把任务留在优先级队列中
+func (q *PriorityQueue) ReturnTask(ctx context.Context, task *taskstruct.Task) error {
+	if err := checkPriority(task.Priority); err != nil {
+		return err
+	}
+	task.Status = taskstruct.TaskStatusPending
+	task.ReadyAt = time.Now().UnixMilli()
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	keys := []string{q.redisEngine.GetName(), q.GetQueueKey(), q.redisEngine.GetQueuesKey(), q.getSeqKey()}
+	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, keys, task.GetTaskKey(), taskData, task.ID, task.Priority, prioritySpan)
+	if err != nil {
+		return fmt.Errorf("任务放回失败: %w", err)
+	}
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+	return nil
+}
+
+// RequeueTask 把未处理完的任务放回本队列，排在同优先级任务的最前面
+func (q *PriorityQueue) RequeueTask(ctx context.Context, task *taskstruct.Task) error {
+	if err := checkPriority(task.Priority); err != nil {
+		return err
+	}
+	task.Status = taskstruct.TaskStatusPending
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	result, err := q.redisEngine.RunScript(ctx, q.requeueScript, []string{q.redisEngine.GetName(), q.GetQueueKey(), q.redisEngine.GetQueuesKey()}, task.GetTaskKey(), taskData, task.ID, int64(task.Priority)*prioritySpan)
+	if err != nil {
+		return fmt.Errorf("任务归还失败: %w", err)
+	}
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+
+	q.logger.Info("task requeued", "queue", q.GetQueueKey(), "task_id", task.ID, "type", task.Type)
+	return nil
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+func TestForwardScheduledPriority(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := NewPriorityQueue("emails", engine)
+	delay := NewDelayQueue("emails", engine, 0)
+
+	low := taskstruct.NewTask("send", nil, 3)
+	low.Priority = 1
+	high := taskstruct.NewTask("send", nil, 3)
+	high.Priority = 9
+	for _, task := range []*taskstruct.Task{low, high} {
+		if err := delay.ScheduleTask(ctx, task, time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := ForwardScheduledPriority(ctx, engine, "emails", time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 2 {
+		t.Fatalf("moved = %d, want 2", moved)
+	}
+	for _, want := range []*taskstruct.Task{high, low} {
+		got, err := q.DequeueTask(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("dequeued priority %d, want %d", got.Priority, want.Priority)
+		}
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"practice/taskstruct"
 
+	"practice/logging"
 	"practice/redisengine"
+	"practice/tracing"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -18,68 +22,216 @@ type Queue struct {
 	queue_type    string
 	enqueueScript *redis.Script
 	dequeueScript *redis.Script
+	requeueScript *redis.Script
+	logger        logging.Logger
+	recorder      Recorder
+	tracer        tracing.Tracer
 }
 
-func NewQueue(name string, redisEngine *redisengine.RedisEngine) *Queue {
-	return &Queue{
+func NewQueue(name string, redisEngine *redisengine.RedisEngine, opts ...Option) *Queue {
+	queue := &Queue{
 		name:          name,
 		redisEngine:   redisEngine,
-		queue_type:    "queue",
+		queue_type:    KindQueue,
 		enqueueScript: enqueueScript,
 		dequeueScript: dequeueScript,
+		requeueScript: requeueScript,
 	}
+	queue.applyOptions(opts)
+	return queue
 }
 
 func (q *Queue) GetQueueKey() string {
 	return fmt.Sprintf("%s:%s", q.queue_type, q.name)
 }
 
+// GetDeadlineKey 本队列中带截止时间的任务按截止时间排序的ZSet，任务本身仍在列表或租户子列表中
+func (q *Queue) GetDeadlineKey() string {
+	return QueueKey(KindDeadline, q.name)
+}
+
+func (q *Queue) GetName() string {
+	return q.name
+}
+
+// AckTask 确认任务处理成功，计入当天的处理数
+func (q *Queue) AckTask(ctx context.Context, task *taskstruct.Task) error {
+	task.Status = taskstruct.TaskStatusCompleted
+	if err := q.recordProcessed(ctx); err != nil {
+		return fmt.Errorf("记录处理数失败: %w", err)
+	}
+	q.recorder.TaskProcessed(q.name, task.Type)
+	return nil
+}
+
+// EnqueueTask 任务设置了 Group 时放入分组等待聚合，设置了 Tenant 时放入租户子列表，否则放入就绪列表
+// 设置了 Deadline 的任务同时记入截止时间ZSet，只有最早截止时间优先调度按截止时间出队，其他情况仍按入队顺序
 func (q *Queue) EnqueueTask(ctx context.Context, task *taskstruct.Task) error {
+	_, span := tracing.StartEnqueueSpan(ctx, q.tracer, q.name, task)
+	defer span.End()
+
+	if task.Group != "" {
+		if err := q.enqueueGroup(ctx, task); err != nil {
+			span.RecordError(err)
+			return err
+		}
+		q.recorder.TaskEnqueued(q.name, task.Type)
+		return nil
+	}
+
 	taskKey := task.GetTaskKey()
 	queueKey := q.GetQueueKey()
 
+	task.ReadyAt = time.Now().UnixMilli()
 	taskData, err := json.Marshal(task)
 	if err != nil {
 		return fmt.Errorf("序列化任务失败: %w", err)
 	}
 
-	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey}, taskKey, taskData, task.ID)
+	var result interface{}
+	if q.queue_type == KindQueue {
+		result, err = q.pushReady(ctx, task, taskData, false)
+	} else {
+		result, err = q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey, q.redisEngine.GetQueuesKey()}, taskKey, taskData, task.ID)
+	}
 	if err != nil {
+		span.RecordError(err)
 		return fmt.Errorf("任务入队失败: %w", err)
 	}
 
 	if result.(int64) == 0 {
-		fmt.Println("任务入队失败，任务已存在: ", task.ID)
-		return nil
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+
+	q.recorder.TaskEnqueued(q.name, task.Type)
+	return nil
+}
+
+// RequeueTask 把已出队但没有处理完的任务放回本队列，下次出队时优先取出
+// 不计入重试次数，也不计入入队数，用于 worker 退出时归还任务
+func (q *Queue) RequeueTask(ctx context.Context, task *taskstruct.Task) error {
+	task.Status = taskstruct.TaskStatusPending
+	task.ReadyAt = time.Now().UnixMilli()
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
+	}
+
+	var result interface{}
+	if q.queue_type == KindQueue {
+		result, err = q.pushReady(ctx, task, taskData, true)
+	} else {
+		result, err = q.redisEngine.RunScript(ctx, q.requeueScript, []string{q.redisEngine.GetName(), q.GetQueueKey(), q.redisEngine.GetQueuesKey()}, task.GetTaskKey(), taskData, task.ID, time.Now().UnixMilli())
+	}
+	if err != nil {
+		return fmt.Errorf("任务归还失败: %w", err)
+	}
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
+
+	q.logger.Info("task requeued", "queue", q.GetQueueKey(), "task_id", task.ID, "type", task.Type)
+	return nil
+}
+
+// ReturnTask 把已出队但暂时不能执行的任务放回同名普通队列的入队端，排在已有任务之后
+// 不计入入队数，用于 worker 等待资源时把任务留在就绪列表中
+func (q *Queue) ReturnTask(ctx context.Context, task *taskstruct.Task) error {
+	task.Status = taskstruct.TaskStatusPending
+	task.ReadyAt = time.Now().UnixMilli()
+
+	taskData, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("序列化任务失败: %w", err)
 	}
 
+	result, err := q.pushReady(ctx, task, taskData, false)
+	if err != nil {
+		return fmt.Errorf("任务放回失败: %w", err)
+	}
+	if result.(int64) == 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
+	}
 	return nil
 }
 
+// 队列是否被暂停，暂停后出队直接返回 ErrQueueEmpty
+func (q *Queue) isPaused(ctx context.Context) (bool, error) {
+	paused, err := q.redisEngine.SIsMember(ctx, q.redisEngine.GetPausedKey(), q.name)
+	if err != nil {
+		return false, fmt.Errorf("读取暂停状态失败: %w", err)
+	}
+	return paused, nil
+}
+
+// DequeueTask 没有就绪任务时返回 ErrQueueEmpty，任务体丢失时返回 ErrTaskNotFound
 func (q *Queue) DequeueTask(ctx context.Context) (*taskstruct.Task, error) {
-	taskID, err := q.redisEngine.RPop(ctx, q.GetQueueKey())
+	paused, err := q.isPaused(ctx)
 	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有就绪任务\n", q.GetQueueKey())
-			return nil, nil
-		}
 		return nil, err
 	}
-	task := taskstruct.Task{ID: taskID}
+	if paused {
+		return nil, ErrQueueEmpty
+	}
 
-	taskKey := task.GetTaskKey()
+	return q.popTask(ctx)
+}
+
+// popTask 执行出队脚本并解析结果，args 追加在任务key前缀之后传给脚本
+func (q *Queue) popTask(ctx context.Context, args ...interface{}) (*taskstruct.Task, error) {
+	queueKey := q.GetQueueKey()
+	scriptArgs := append([]interface{}{taskstruct.TaskKeyPrefix}, args...)
 
-	taskData, err := q.redisEngine.RunScript(ctx, q.dequeueScript, []string{q.redisEngine.GetName(), q.GetQueueKey()}, taskKey)
+	keys := []string{q.redisEngine.GetName(), queueKey}
+	if q.queue_type == KindQueue {
+		keys = append(keys, q.GetDeadlineKey(), q.GetTenantsKey(), q.GetDeficitKey(), TenantWeightsKey(q.redisEngine.GetName()))
+		scriptArgs = append(scriptArgs, q.name)
+	}
+	result, err := q.redisEngine.RunScript(ctx, q.dequeueScript, keys, scriptArgs...)
 	if err != nil {
 		if err == redis.Nil {
-			fmt.Printf("%s 没有找到任务\n", taskKey)
-			return nil, nil
+			q.logger.Debug("queue is empty", "queue", queueKey)
+			return nil, ErrQueueEmpty
 		}
-		return nil, err
+		return nil, fmt.Errorf("任务出队失败: %w", err)
 	}
 
-	if err := json.Unmarshal([]byte(taskData.(string)), &task); err != nil {
-		return nil, err
+	return q.DecodeDequeued(ctx, result.([]interface{}))
+}
+
+// DecodeDequeued 解析出队脚本返回的 {任务ID, 到期时间, 任务体}，并记录出队指标
+// 供在其他脚本中完成出队的调用方(如调度器)使用
+func (q *Queue) DecodeDequeued(ctx context.Context, values []interface{}) (*taskstruct.Task, error) {
+	task := taskstruct.Task{ID: values[0].(string)}
+	readyAtMilli, err := strconv.ParseInt(values[1].(string), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("解析到期时间失败: %w", err)
 	}
+	if len(values) < 3 {
+		return nil, q.handleOrphan(ctx, task.ID)
+	}
+
+	if err := json.Unmarshal([]byte(values[2].(string)), &task); err != nil {
+		return nil, fmt.Errorf("反序列化任务失败: %w", err)
+	}
+	task.Queue = q.name
+	_, span := tracing.StartDequeueSpan(ctx, q.tracer, q.name, &task)
+	span.End()
+
+	readyAt := task.ReadyTime()
+	if readyAtMilli > 0 {
+		readyAt = time.UnixMilli(readyAtMilli)
+	}
+	q.recorder.TaskDequeued(q.name, task.Type, time.Since(readyAt))
 	return &task, nil
 }
+
+// handleOrphan 任务ID已经出队但任务体不存在，记录到孤儿集合供排查
+func (q *Queue) handleOrphan(ctx context.Context, taskID string) error {
+	q.logger.Warn("orphan task id dequeued without body", "queue", q.GetQueueKey(), "task_id", taskID)
+	if err := q.redisEngine.SAdd(ctx, q.redisEngine.GetOrphansKey(), taskID); err != nil {
+		return fmt.Errorf("记录孤儿任务 %s 失败: %w", taskID, err)
+	}
+	return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+type latencyRecorder struct {
+	nopRecorder
+	mutex     sync.Mutex
+	latencies []time.Duration
+}
+
+func (r *latencyRecorder) TaskDequeued(queue, taskType string, latency time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.latencies = append(r.latencies, latency)
+}
+
+func TestDequeueLatencyUsesReadyAt(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	recorder := &latencyRecorder{}
+	q := NewQueue("emails", engine, WithRecorder(recorder))
+
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Created = time.Now().Add(-time.Hour)
+	if err := q.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.DequeueTask(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorder.latencies) != 1 || recorder.latencies[0] > time.Minute {
+		t.Fatalf("latencies = %v, want one latency measured from ReadyAt", recorder.latencies)
+	}
+}
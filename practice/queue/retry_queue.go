@@ -9,8 +9,6 @@ import (
 	"practice/taskstruct"
 	"sync"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 type RetryQueue struct {
@@ -22,21 +20,24 @@ type RetryQueue struct {
 	mutex     sync.Mutex
 }
 
-func NewRetryQueue(name string, redisEngine *redisengine.RedisEngine, delayDuration time.Duration, maxDelay time.Duration, maxRetry int) *RetryQueue {
+func NewRetryQueue(name string, redisEngine *redisengine.RedisEngine, delayDuration time.Duration, maxDelay time.Duration, maxRetry int, opts ...Option) *RetryQueue {
 	queue := Queue{
 		name:          name,
 		redisEngine:   redisEngine,
-		queue_type:    "retry_queue",
+		queue_type:    KindRetry,
 		enqueueScript: delayEnqueueScript,
-		dequeueScript: dequeueScript,
+		dequeueScript: delayDequeueScript,
+		requeueScript: delayRequeueScript,
 	}
+	queue.applyOptions(opts)
 
 	return &RetryQueue{
 		Queue:     queue,
 		baseDelay: delayDuration,
 		maxDelay:  maxDelay,
 		maxRetry:  maxRetry,
-		deadQueue: NewDeadQueue("dead_queue", redisEngine),
+		// 死信队列与重试队列同名(dead_queue:<name>)；旧版本统一写入 dead_queue:dead_queue，升级说明见 README
+		deadQueue: NewDeadQueue(name, redisEngine, opts...),
 	}
 }
 
@@ -45,6 +46,11 @@ func (q *RetryQueue) getQueueKey() string {
 }
 
 func (q *RetryQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) error {
+	if err := q.recordFailed(ctx); err != nil {
+		return fmt.Errorf("记录失败数失败: %w", err)
+	}
+	q.recorder.TaskFailed(q.name, task.Type)
+
 	task.Retry++
 	if task.Retry > q.maxRetry {
 		task.Status = taskstruct.TaskStatusDeadLetter
@@ -54,65 +60,60 @@ func (q *RetryQueue) EnqueueTask(ctx context.Context, task *taskstruct.Task) err
 
 	// 修正版本
 	exponentialDelay := q.baseDelay * time.Duration(1<<uint(task.Retry))
-	jitter := time.Duration(rand.Intn(int(exponentialDelay / 4)))
+	// 退避过小时 rand.Intn 的参数为0会 panic，此时不加抖动
+	var jitter time.Duration
+	if exponentialDelay/4 > 0 {
+		jitter = time.Duration(rand.Int63n(int64(exponentialDelay / 4)))
+	}
 	delayDuration := exponentialDelay + jitter
-	if delayDuration > q.maxDelay {
+	if q.maxDelay > 0 && delayDuration > q.maxDelay {
 		delayDuration = q.maxDelay
 	}
 
 	taskKey := task.GetTaskKey()
 	queueKey := q.getQueueKey()
 
+	// 退避从本次失败开始计算，而不是任务创建时间
+	task.ReadyAt = time.Now().Add(delayDuration).UnixMilli()
 	taskData, err := json.Marshal(task)
 	if err != nil {
 		return fmt.Errorf("序列化任务失败: %w", err)
 	}
-	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey}, taskKey, taskData, task.Created.Add(delayDuration).UnixMilli(), task.ID)
+	result, err := q.redisEngine.RunScript(ctx, q.enqueueScript, []string{q.redisEngine.GetName(), queueKey, q.redisEngine.GetQueuesKey()}, taskKey, taskData, task.ReadyAt, task.ID)
 	if err != nil {
 		return fmt.Errorf("任务入队失败: %w", err)
 	}
 
 	if result.(int64) == 0 {
-		fmt.Println("任务入队失败，任务已存在: ", task.ID)
-		return nil
+		return fmt.Errorf("%w: %s", ErrDuplicateTask, task.ID)
 	}
 
+	q.logger.Info("task scheduled for retry", "queue", queueKey, "task_id", task.ID, "type", task.Type, "attempt", task.Retry, "delay", delayDuration)
+	q.recorder.TaskRetried(q.name, task.Type)
 	return nil
 }
 
-func (q *RetryQueue) DequeueTask(ctx context.Context) (*taskstruct.Task, error) {
-	q.mutex.Lock()
-	defer q.mutex.Unlock()
-
-	currentTime := time.Now().UnixMilli()
-	taskID, err := q.redisEngine.ZRangeByScore(ctx, q.getQueueKey(), "-inf", fmt.Sprintf("%d", currentTime), 0, 1)
-	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有就绪任务\n", q.getQueueKey())
-			return nil, nil
-		}
-		return nil, fmt.Errorf("延迟队列出队失败: %w", err)
-	}
-	if len(taskID) == 0 {
-		fmt.Printf("%s 没有就绪任务\n", q.getQueueKey())
-		return nil, nil
+// DeadLetterTask 记录一次失败并直接把任务放入死信队列，不再重试
+func (q *RetryQueue) DeadLetterTask(ctx context.Context, task *taskstruct.Task) error {
+	if err := q.recordFailed(ctx); err != nil {
+		return fmt.Errorf("记录失败数失败: %w", err)
 	}
+	q.recorder.TaskFailed(q.name, task.Type)
 
-	task := taskstruct.Task{ID: taskID[0]}
+	return q.deadQueue.EnqueueTask(ctx, task)
+}
 
-	taskKey := task.GetTaskKey()
+func (q *RetryQueue) DequeueTask(ctx context.Context) (*taskstruct.Task, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
 
-	taskData, err := q.redisEngine.RunScript(ctx, q.dequeueScript, []string{q.redisEngine.GetName()}, taskKey)
+	paused, err := q.isPaused(ctx)
 	if err != nil {
-		if err == redis.Nil {
-			fmt.Printf("%s 没有找到任务\n", taskKey)
-			return nil, nil
-		}
 		return nil, err
 	}
-
-	if err := json.Unmarshal([]byte(taskData.(string)), &task); err != nil {
-		return nil, err
+	if paused {
+		return nil, ErrQueueEmpty
 	}
-	return &task, nil
+
+	return q.popTask(ctx, time.Now().UnixMilli())
 }
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+func TestRetryDelayStartsFromNow(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := NewRetryQueue("emails", engine, time.Minute, time.Hour, 3)
+
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Created = time.Now().Add(-24 * time.Hour)
+	before := time.Now()
+	if err := q.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次重试退避 2 分钟，加上最多四分之一的抖动
+	readyAt := time.UnixMilli(task.ReadyAt)
+	if readyAt.Before(before.Add(2*time.Minute)) || readyAt.After(time.Now().Add(150*time.Second)) {
+		t.Fatalf("ReadyAt = %v, want about 2 minutes after %v", readyAt, before)
+	}
+	if _, err := q.DequeueTask(ctx); err != ErrQueueEmpty {
+		t.Fatalf("DequeueTask error = %v, want ErrQueueEmpty before backoff elapses", err)
+	}
+}
+
+func TestRetryTinyBaseDelay(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := NewRetryQueue("emails", engine, time.Nanosecond, 0, 3)
+
+	task := taskstruct.NewTask("send", nil, 3)
+	if err := q.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+}
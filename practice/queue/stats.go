@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 队列种类，同时也是队列key的前缀
+const (
+	KindQueue = "queue"
+	KindDelay = "delay_queue"
+	KindRetry = "retry_queue"
+	KindDead  = "dead_queue"
+
+	KindPriority = "priority_queue"
+	KindDeadline = "deadline_queue" // 普通队列中带截止时间的任务，按截止时间排序
+)
+
+// 每日统计计数的保留时间
+const statsTTL = 90 * 24 * time.Hour
+
+const statsDateLayout = "2006-01-02"
+
+// QueueKey 拼接队列key，格式为 种类:名称
+func QueueKey(kind, name string) string {
+	return fmt.Sprintf("%s:%s", kind, name)
+}
+
+// ParseQueueKey 把队列key拆分为种类和名称
+func ParseQueueKey(queueKey string) (kind, name string, ok bool) {
+	kind, name, ok = strings.Cut(queueKey, ":")
+	if !ok {
+		return "", "", false
+	}
+	switch kind {
+	case KindQueue, KindDelay, KindRetry, KindDead, KindPriority, KindDeadline:
+		return kind, name, true
+	}
+	return "", "", false
+}
+
+// ProcessedKey 某队列某天处理成功的计数key
+func ProcessedKey(namespace, name string, day time.Time) string {
+	return fmt.Sprintf("%s:processed:%s:%s", namespace, name, day.Format(statsDateLayout))
+}
+
+// FailedKey 某队列某天处理失败的计数key
+func FailedKey(namespace, name string, day time.Time) string {
+	return fmt.Sprintf("%s:failed:%s:%s", namespace, name, day.Format(statsDateLayout))
+}
+
+// 记录一次处理成功
+func (q *Queue) recordProcessed(ctx context.Context) error {
+	key := ProcessedKey(q.redisEngine.GetName(), q.name, time.Now())
+	return q.redisEngine.IncrWithExpire(ctx, key, statsTTL)
+}
+
+// 记录一次处理失败
+func (q *Queue) recordFailed(ctx context.Context) error {
+	key := FailedKey(q.redisEngine.GetName(), q.name, time.Now())
+	return q.redisEngine.IncrWithExpire(ctx, key, statsTTL)
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"practice/redisengine"
+	"practice/taskstruct"
+)
+
+// 多租户公平队列：带 Tenant 的任务放入所属租户的子列表，有任务的租户按到达顺序排成一个环
+// 出队时按赤字轮询(DRR)在租户之间轮转，每轮租户可以取出的任务数为它的权重，默认为1
+
+// TenantKey 某队列中某租户的子列表，左进右出
+func TenantKey(namespace, name, tenant string) string {
+	return fmt.Sprintf("%s:tenant:%s:%s", namespace, name, tenant)
+}
+
+// TenantsKey 某队列中有待处理任务的租户组成的环，列表左端为当前轮到的租户
+func TenantsKey(namespace, name string) string {
+	return fmt.Sprintf("%s:tenants:%s", namespace, name)
+}
+
+// DeficitKey 某队列中各租户本轮剩余的可出队数
+func DeficitKey(namespace, name string) string {
+	return fmt.Sprintf("%s:deficit:%s", namespace, name)
+}
+
+// NotifyKey 某队列的唤醒列表，任务放入就绪状态时留下一个信号，阻塞等待的消费者 BRPOP 它后再用出队脚本取任务
+// 信号只表示可能有任务，列表中至多保留一个
+func NotifyKey(namespace, name string) string {
+	return fmt.Sprintf("%s:notify:%s", namespace, name)
+}
+
+// TenantWeightsKey 租户->权重 的Hash，对所有队列生效
+func TenantWeightsKey(namespace string) string {
+	return fmt.Sprintf("%s:tenant_weights", namespace)
+}
+
+// PopTenantLua 定义 Lua 函数 popTenant，拼接在出队脚本之前使用
+// 轮到的租户由租户环决定，租户子列表的key在脚本中按 TenantKey 的格式拼出，无法事先在 KEYS 中声明
+// popTenant(ns, name, listKey, ringKey, deficitKey, weightsKey, withDefault) 按赤字轮询取出一个租户任务ID，没有租户任务时返回nil
+// 租户 "" 表示普通列表，withDefault 为 true 时没有租户的任务也作为一个租户参与轮询
+const PopTenantLua = `
+local function popTenant(ns, name, listKey, ringKey, deficitKey, weightsKey, withDefault)
+    if withDefault and redis.call("LLEN", listKey) > 0 and not redis.call("LPOS", ringKey, "") then
+        redis.call("RPUSH", ringKey, "")
+    end
+    for _ = 1, redis.call("LLEN", ringKey) do
+        local tenant = redis.call("LINDEX", ringKey, 0)
+        local subKey = listKey
+        if tenant ~= "" then
+            subKey = ns .. ":tenant:" .. name .. ":" .. tenant
+        end
+        local taskID = redis.call("RPOP", subKey)
+        if taskID then
+            local deficit = tonumber(redis.call("HGET", deficitKey, tenant) or "0")
+            if deficit <= 0 then
+                deficit = math.max(1, tonumber(redis.call("HGET", weightsKey, tenant) or "1"))
+            end
+            deficit = deficit - 1
+            if redis.call("LLEN", subKey) == 0 then
+                redis.call("LPOP", ringKey)
+                redis.call("HDEL", deficitKey, tenant)
+            elseif deficit <= 0 then
+                redis.call("RPUSH", ringKey, redis.call("LPOP", ringKey))
+                redis.call("HDEL", deficitKey, tenant)
+            else
+                redis.call("HSET", deficitKey, tenant, deficit)
+            end
+            return taskID
+        end
+        redis.call("LPOP", ringKey)
+        redis.call("HDEL", deficitKey, tenant)
+    end
+    return nil
+end
+`
+
+// GetTenantsKey 本队列的租户环
+func (q *Queue) GetTenantsKey() string {
+	return TenantsKey(q.redisEngine.GetName(), q.name)
+}
+
+// GetDeficitKey 本队列各租户本轮剩余的可出队数
+func (q *Queue) GetDeficitKey() string {
+	return DeficitKey(q.redisEngine.GetName(), q.name)
+}
+
+// pushReady 保存任务体并按 ReadyRoute 把任务放入同名普通队列，front 为 true 时放在出队端
+func (q *Queue) pushReady(ctx context.Context, task *taskstruct.Task, taskData []byte, front bool) (interface{}, error) {
+	tenant, deadline := ReadyRoute(task)
+	keys := append([]string{q.redisEngine.GetName()}, ReadyKeys(q.redisEngine, q.name, tenant)...)
+	frontFlag := 0
+	if front {
+		frontFlag = 1
+	}
+	return q.redisEngine.RunScript(ctx, readyEnqueueScript, keys, task.GetTaskKey(), taskData, task.ID, tenant, deadline, frontFlag)
+}
+
+// ReadyKeys PushReadyLua 需要在 KEYS 中声明的key，依次为
+// 普通列表、租户子列表、截止时间ZSet、租户环、唤醒列表、队列注册集合，没有租户时租户子列表的位置为普通列表
+func ReadyKeys(redisEngine *redisengine.RedisEngine, name, tenant string) []string {
+	namespace := redisEngine.GetName()
+	listKey := QueueKey(KindQueue, name)
+	tenantKey := listKey
+	if tenant != "" {
+		tenantKey = TenantKey(namespace, name, tenant)
+	}
+	return []string{listKey, tenantKey, QueueKey(KindDeadline, name), TenantsKey(namespace, name), NotifyKey(namespace, name), redisEngine.GetQueuesKey()}
+}
+
+// ReadyRoute 任务进入普通队列时的路由参数，供 PushReadyLua 使用
+// 返回租户和截止时间(毫秒)，没有截止时间时为0
+func ReadyRoute(task *taskstruct.Task) (string, int64) {
+	var deadline int64
+	if !task.Deadline.IsZero() {
+		deadline = task.Deadline.UnixMilli()
+	}
+	return task.Tenant, deadline
+}
+
+// Tenants 返回有待处理任务的租户，按轮询顺序排列
+func (q *Queue) Tenants(ctx context.Context) ([]string, error) {
+	tenants, err := q.redisEngine.LRange(ctx, q.GetTenantsKey(), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("读取租户失败: %w", err)
+	}
+	return tenants, nil
+}
+
+// SetTenantWeight 设置租户每轮可以取出的任务数，weight 不大于0时恢复默认值1
+func SetTenantWeight(ctx context.Context, redisEngine *redisengine.RedisEngine, tenant string, weight int) error {
+	key := TenantWeightsKey(redisEngine.GetName())
+	var err error
+	if weight <= 0 {
+		err = redisEngine.HDel(ctx, key, tenant)
+	} else {
+		err = redisEngine.HSet(ctx, key, tenant, weight)
+	}
+	if err != nil {
+		return fmt.Errorf("设置租户 %s 权重失败: %w", tenant, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+// 就绪列表中一直有任务时，租户任务仍按赤字轮询与没有租户的任务交替出队
+func TestDequeueRotatesTenants(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	q := NewQueue("emails", engine)
+
+	for i := 0; i < 3; i++ {
+		for _, tenant := range []string{"", "acme"} {
+			task := taskstruct.NewTask("send", nil, 3)
+			task.Tenant = tenant
+			if err := q.EnqueueTask(ctx, task); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		task, err := q.DequeueTask(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, task.Tenant)
+	}
+	for i := 1; i < len(order); i++ {
+		if order[i] == order[i-1] {
+			t.Fatalf("tenant order = %q, want tenants to alternate", order)
+		}
+	}
+	if tenants, err := q.Tenants(ctx); err != nil || len(tenants) != 0 {
+		t.Fatalf("tenants = %v (%v), want none", tenants, err)
+	}
+}
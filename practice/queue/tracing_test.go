@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+	"practice/tracing"
+)
+
+// 出队span与入队span属于同一条链路，父span为入队span
+func TestDequeueSpanContinuesEnqueueTrace(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	recorder := tracing.NewRecorder()
+	q := NewQueue("emails", engine, WithTracer(recorder))
+
+	if err := q.EnqueueTask(ctx, taskstruct.NewTask("send", nil, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.DequeueTask(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	enqueue, dequeue := spans[0], spans[1]
+	if enqueue.Name != tracing.SpanEnqueue || dequeue.Name != tracing.SpanDequeue {
+		t.Fatalf("span names = %s, %s, want %s, %s", enqueue.Name, dequeue.Name, tracing.SpanEnqueue, tracing.SpanDequeue)
+	}
+	if dequeue.SpanContext.TraceID != enqueue.SpanContext.TraceID {
+		t.Fatalf("dequeue trace = %s, want %s", dequeue.SpanContext.TraceID, enqueue.SpanContext.TraceID)
+	}
+	if dequeue.Parent.SpanID != enqueue.SpanContext.SpanID {
+		t.Fatalf("dequeue parent = %s, want %s", dequeue.Parent.SpanID, enqueue.SpanContext.SpanID)
+	}
+}
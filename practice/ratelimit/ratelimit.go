@@ -0,0 +1,153 @@
+// 分布式限流
+
+// 基于 GCRA 算法，状态保存在 Redis 中，多个 worker 共享同一个配额
+// 规则可以按队列、任务类型或负载中的字段区分限流key
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limit 每 Period 最多 Rate 次，Burst 为允许的突发次数，小于1时按1处理
+// 精度为毫秒，平均间隔小于1毫秒的规则不生效
+type Limit struct {
+	Rate   int
+	Period time.Duration
+	Burst  int
+}
+
+// interval 两次请求之间的平均间隔
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Rate)
+}
+
+func (l Limit) burst() int {
+	if l.Burst < 1 {
+		return 1
+	}
+	return l.Burst
+}
+
+// Rule 限流规则，Key 返回任务对应的限流key，返回空字符串表示规则不适用于该任务
+type Rule struct {
+	Limit Limit
+	Key   func(task *taskstruct.Task) string
+}
+
+// QueueRule 限制某个队列中所有任务的执行速率
+func QueueRule(queueName string, limit Limit) Rule {
+	return Rule{
+		Limit: limit,
+		Key: func(task *taskstruct.Task) string {
+			if task.Queue != queueName {
+				return ""
+			}
+			return "queue:" + queueName
+		},
+	}
+}
+
+// TypeRule 限制某种类型任务的执行速率
+func TypeRule(taskType string, limit Limit) Rule {
+	return Rule{
+		Limit: limit,
+		Key: func(task *taskstruct.Task) string {
+			if task.Type != taskType {
+				return ""
+			}
+			return "type:" + taskType
+		},
+	}
+}
+
+// PayloadRule 按负载中某个字段的值分别限制某种类型任务的执行速率，例如每个客户单独计算配额
+// 负载中没有该字段的任务不受限制
+func PayloadRule(taskType, field string, limit Limit) Rule {
+	return Rule{
+		Limit: limit,
+		Key: func(task *taskstruct.Task) string {
+			if task.Type != taskType {
+				return ""
+			}
+			value, ok := task.Payload[field]
+			if !ok {
+				return ""
+			}
+			return fmt.Sprintf("type:%s:%s:%v", taskType, field, value)
+		},
+	}
+}
+
+// limitScript GCRA 限流，KEYS 为各规则的限流key，ARGV 依次为每个key的 间隔(毫秒) 和 突发次数
+// 所有key都允许时一起扣减配额并返回0，否则不扣减，返回最早可以执行的等待时间(毫秒)
+var limitScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local newTats = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+    local interval = tonumber(ARGV[i * 2 - 1])
+    local burst = tonumber(ARGV[i * 2])
+    local tat = tonumber(redis.call("GET", key) or now)
+    if tat < now then
+        tat = now
+    end
+    local newTat = tat + interval
+    local allowAt = newTat - interval * burst
+    if allowAt > now then
+        wait = math.max(wait, allowAt - now)
+    end
+    newTats[i] = newTat
+end
+
+if wait > 0 then
+    return wait
+end
+
+for i, key in ipairs(KEYS) do
+    redis.call("SET", key, newTats[i], "PX", newTats[i] - now)
+end
+
+return 0
+`)
+
+type Limiter struct {
+	redisEngine *redisengine.RedisEngine
+	rules       []Rule
+}
+
+func NewLimiter(redisEngine *redisengine.RedisEngine, rules ...Rule) *Limiter {
+	return &Limiter{redisEngine: redisEngine, rules: rules}
+}
+
+// Reserve 检查任务适用的所有规则，允许执行时扣减配额并返回0，
+// 否则不扣减任何配额，返回需要等待的时间
+func (l *Limiter) Reserve(ctx context.Context, task *taskstruct.Task) (time.Duration, error) {
+	keys := []string{}
+	args := []interface{}{}
+	for _, rule := range l.rules {
+		key := rule.Key(task)
+		if key == "" || rule.Limit.Rate <= 0 || rule.Limit.interval() < time.Millisecond {
+			continue
+		}
+		keys = append(keys, l.redisEngine.GetRateLimitKey(key))
+		args = append(args, rule.Limit.interval().Milliseconds(), rule.Limit.burst())
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	result, err := l.redisEngine.RunScript(ctx, limitScript, keys, args...)
+	if err != nil {
+		return 0, fmt.Errorf("限流检查失败: %w", err)
+	}
+	return time.Duration(result.(int64)) * time.Millisecond, nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/taskstruct"
+)
+
+func TestReserveAllowsBurstThenWaits(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	limiter := NewLimiter(engine, TypeRule("send", Limit{Rate: 1, Period: time.Hour, Burst: 3}))
+	task := taskstruct.NewTask("send", nil, 3)
+
+	for i := 0; i < 3; i++ {
+		wait, err := limiter.Reserve(ctx, task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait != 0 {
+			t.Fatalf("reserve %d wait = %s, want 0 within burst", i, wait)
+		}
+	}
+	wait, err := limiter.Reserve(ctx, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait < 59*time.Minute || wait > time.Hour {
+		t.Fatalf("wait = %s, want about one interval", wait)
+	}
+
+	// 其他类型不受该规则限制
+	if wait, err := limiter.Reserve(ctx, taskstruct.NewTask("other", nil, 3)); err != nil || wait != 0 {
+		t.Fatalf("other type reserve = %s, %v, want 0, nil", wait, err)
+	}
+}
+
+func TestReserveDeniedDoesNotConsumeOtherRules(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Queue = "emails"
+	queueRule := QueueRule("emails", Limit{Rate: 10, Period: time.Hour, Burst: 2})
+	limiter := NewLimiter(engine, queueRule, TypeRule("send", Limit{Rate: 1, Period: time.Hour, Burst: 1}))
+
+	if wait, err := limiter.Reserve(ctx, task); err != nil || wait != 0 {
+		t.Fatalf("first reserve = %s, %v, want 0, nil", wait, err)
+	}
+	// 类型规则拒绝时队列规则的配额也不扣减
+	for i := 0; i < 3; i++ {
+		if wait, err := limiter.Reserve(ctx, task); err != nil || wait == 0 {
+			t.Fatalf("reserve %d = %s, %v, want a wait", i, wait, err)
+		}
+	}
+	if wait, err := NewLimiter(engine, queueRule).Reserve(ctx, task); err != nil || wait != 0 {
+		t.Fatalf("queue rule reserve = %s, %v, want remaining burst", wait, err)
+	}
+}
@@ -2,6 +2,8 @@ package redisengine
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -23,6 +25,11 @@ func (engine *RedisEngine) RPop(ctx context.Context, queueKey string) (string, e
 	return engine.client.RPop(ctx, queueKey).Result()
 }
 
+// BRPop 按顺序从第一个非空列表右端弹出，返回 {列表key, 值}，超时返回 redis.Nil
+func (engine *RedisEngine) BRPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	return engine.client.BRPop(ctx, timeout, keys...).Result()
+}
+
 func (engine *RedisEngine) RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
 	return script.Run(ctx, engine.client, keys, args).Result()
 }
@@ -132,3 +139,125 @@ func (engine *RedisEngine) HIncrByBatch(ctx context.Context, key string, fieldIn
 
 	return results, nil
 }
+
+// 所有已注册队列key的集合
+func (engine *RedisEngine) GetQueuesKey() string {
+	return fmt.Sprintf("%s:queues", engine.engine_name)
+}
+
+// List操作方法
+func (engine *RedisEngine) LLen(ctx context.Context, key string) (int64, error) {
+	return engine.client.LLen(ctx, key).Result()
+}
+
+func (engine *RedisEngine) LIndex(ctx context.Context, key string, index int64) (string, error) {
+	return engine.client.LIndex(ctx, key, index).Result()
+}
+
+func (engine *RedisEngine) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return engine.client.LRange(ctx, key, start, stop).Result()
+}
+
+func (engine *RedisEngine) ZCard(ctx context.Context, key string) (int64, error) {
+	return engine.client.ZCard(ctx, key).Result()
+}
+
+// 按下标升序返回成员及分数
+func (engine *RedisEngine) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return engine.client.ZRangeWithScores(ctx, key, start, stop).Result()
+}
+
+// 按下标降序返回成员及分数
+func (engine *RedisEngine) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return engine.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+}
+
+func (engine *RedisEngine) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	return engine.client.HMGet(ctx, key, fields...).Result()
+}
+
+// Set操作方法
+func (engine *RedisEngine) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return engine.client.SAdd(ctx, key, members...).Err()
+}
+
+func (engine *RedisEngine) SMembers(ctx context.Context, key string) ([]string, error) {
+	return engine.client.SMembers(ctx, key).Result()
+}
+
+// String操作方法
+func (engine *RedisEngine) Get(ctx context.Context, key string) (string, error) {
+	return engine.client.Get(ctx, key).Result()
+}
+
+// 计数加一并刷新过期时间
+func (engine *RedisEngine) IncrWithExpire(ctx context.Context, key string, ttl time.Duration) error {
+	pipe := engine.client.TxPipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// 已暂停队列名称的集合
+func (engine *RedisEngine) GetPausedKey() string {
+	return fmt.Sprintf("%s:paused", engine.engine_name)
+}
+
+func (engine *RedisEngine) SRem(ctx context.Context, key string, members ...interface{}) error {
+	return engine.client.SRem(ctx, key, members...).Err()
+}
+
+func (engine *RedisEngine) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return engine.client.SIsMember(ctx, key, member).Result()
+}
+
+// 出队时发现任务体已丢失的孤儿任务ID集合
+func (engine *RedisEngine) GetOrphansKey() string {
+	return fmt.Sprintf("%s:orphans", engine.engine_name)
+}
+
+func (engine *RedisEngine) SetWithExpire(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return engine.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (engine *RedisEngine) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	return engine.client.MGet(ctx, keys...).Result()
+}
+
+func (engine *RedisEngine) Del(ctx context.Context, keys ...string) error {
+	return engine.client.Del(ctx, keys...).Err()
+}
+
+func (engine *RedisEngine) ZRem(ctx context.Context, key string, members ...interface{}) error {
+	return engine.client.ZRem(ctx, key, members...).Err()
+}
+
+// 删除分数在 [min, max] 之间的成员
+func (engine *RedisEngine) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	return engine.client.ZRemRangeByScore(ctx, key, min, max).Err()
+}
+
+func (engine *RedisEngine) HDel(ctx context.Context, key string, fields ...string) error {
+	return engine.client.HDel(ctx, key, fields...).Err()
+}
+
+// 存活的 worker，成员为 worker ID，分数为心跳过期时间(毫秒)
+func (engine *RedisEngine) GetWorkersKey() string {
+	return fmt.Sprintf("%s:workers", engine.engine_name)
+}
+
+// 单个 worker 的信息，随心跳刷新过期时间
+func (engine *RedisEngine) GetWorkerKey(workerID string) string {
+	return fmt.Sprintf("%s:workers:%s", engine.engine_name, workerID)
+}
+
+// 正在处理的任务，字段为任务ID，值为所属 worker 和任务体
+func (engine *RedisEngine) GetActiveKey() string {
+	return fmt.Sprintf("%s:active", engine.engine_name)
+}
+
+// 限流状态，key 由限流规则生成
+func (engine *RedisEngine) GetRateLimitKey(key string) string {
+	return fmt.Sprintf("%s:ratelimit:%s", engine.engine_name, key)
+}
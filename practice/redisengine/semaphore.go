@@ -0,0 +1,77 @@
+package redisengine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分布式信号量，每个租约是ZSet中的一个成员，分数为租约过期时间(毫秒)
+// 持有者需要在过期前续约，持有者消失后租约自动过期，名额在下次申请时回收
+
+// acquireSemaphoreScript 先清理过期租约，有空余名额时加入租约并返回1，否则返回0
+// 同一个租约重复申请时只刷新过期时间
+var acquireSemaphoreScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now)
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) == false and redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+    return 0
+end
+
+redis.call("ZADD", KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[3]) then
+    redis.call("PEXPIRE", KEYS[1], ARGV[3])
+end
+
+return 1
+`)
+
+// extendSemaphoreScript 租约仍然有效时刷新过期时间并返回1，已过期或已释放返回0
+var extendSemaphoreScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local expireAt = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if expireAt == false or tonumber(expireAt) <= now then
+    return 0
+end
+
+redis.call("ZADD", KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[2]) then
+    redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+
+return 1
+`)
+
+// 信号量的租约集合
+func (engine *RedisEngine) GetSemaphoreKey(name string) string {
+	return fmt.Sprintf("%s:semaphore:%s", engine.engine_name, name)
+}
+
+// AcquireSemaphore 申请信号量 name 的一个名额，最多 limit 个租约同时有效，租约在 ttl 后过期
+func (engine *RedisEngine) AcquireSemaphore(ctx context.Context, name, leaseID string, limit int, ttl time.Duration) (bool, error) {
+	result, err := engine.RunScript(ctx, acquireSemaphoreScript, []string{engine.GetSemaphoreKey(name)}, leaseID, limit, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+// ExtendSemaphore 续约，返回 false 表示租约已经过期，名额可能已被其他持有者占用
+func (engine *RedisEngine) ExtendSemaphore(ctx context.Context, name, leaseID string, ttl time.Duration) (bool, error) {
+	result, err := engine.RunScript(ctx, extendSemaphoreScript, []string{engine.GetSemaphoreKey(name)}, leaseID, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+// ReleaseSemaphore 释放租约
+func (engine *RedisEngine) ReleaseSemaphore(ctx context.Context, name, leaseID string) error {
+	return engine.client.ZRem(ctx, engine.GetSemaphoreKey(name), leaseID).Err()
+}
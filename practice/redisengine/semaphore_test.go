@@ -0,0 +1,57 @@
+package redisengine_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+)
+
+func TestSemaphoreLimit(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+
+	for _, lease := range []string{"a", "b"} {
+		if ok, err := engine.AcquireSemaphore(ctx, "export", lease, 2, time.Minute); err != nil || !ok {
+			t.Fatalf("acquire %s = %v, %v, want true", lease, ok, err)
+		}
+	}
+	if ok, err := engine.AcquireSemaphore(ctx, "export", "c", 2, time.Minute); err != nil || ok {
+		t.Fatalf("acquire c = %v, %v, want false when full", ok, err)
+	}
+	// 已持有的租约重复申请只刷新过期时间
+	if ok, err := engine.AcquireSemaphore(ctx, "export", "a", 2, time.Minute); err != nil || !ok {
+		t.Fatalf("reacquire a = %v, %v, want true", ok, err)
+	}
+
+	if err := engine.ReleaseSemaphore(ctx, "export", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := engine.AcquireSemaphore(ctx, "export", "c", 2, time.Minute); err != nil || !ok {
+		t.Fatalf("acquire c after release = %v, %v, want true", ok, err)
+	}
+}
+
+func TestSemaphoreExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	mr, engine := testredis.New(t)
+	now := time.Now()
+	mr.SetTime(now)
+
+	if ok, err := engine.AcquireSemaphore(ctx, "export", "a", 1, time.Second); err != nil || !ok {
+		t.Fatalf("acquire a = %v, %v, want true", ok, err)
+	}
+	if ok, err := engine.ExtendSemaphore(ctx, "export", "a", time.Second); err != nil || !ok {
+		t.Fatalf("extend a = %v, %v, want true", ok, err)
+	}
+
+	// 租约过期后名额被回收，过期的持有者不能续约
+	mr.SetTime(now.Add(2 * time.Second))
+	if ok, err := engine.AcquireSemaphore(ctx, "export", "b", 1, time.Second); err != nil || !ok {
+		t.Fatalf("acquire b after expiry = %v, %v, want true", ok, err)
+	}
+	if ok, err := engine.ExtendSemaphore(ctx, "export", "a", time.Second); err != nil || ok {
+		t.Fatalf("extend expired a = %v, %v, want false", ok, err)
+	}
+}
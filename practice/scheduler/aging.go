@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 老化模式：队列的有效优先级 = 配置的优先级 + 队首任务每等待一个 agingInterval 加一，最多加 agingMaxBoost
+// 高优先级队列一直繁忙时，低优先级队列的任务等待足够久后也会被取出
+
+// agingDequeueScript 计算每个未暂停队列的有效优先级，从有效优先级最高的队列出队
+// 有效优先级相同时按配置顺序(优先级从高到低)选择；队首任务没有 ready_at 时等待时间按0计算
+// ARGV[2..4] 为 当前毫秒时间、老化间隔(毫秒)、最大提升(0表示不限)，其余 KEYS、ARGV 的格式见 queueLua
+// 返回格式同 weightDequeueScript
+var agingDequeueScript = redis.NewScript(queueLua + `
+local now = tonumber(ARGV[2])
+local interval = tonumber(ARGV[3])
+local maxBoost = tonumber(ARGV[4])
+
+local selected
+local maxPriority
+for i = 1, queueCount(3) do
+    local q = queueAt(3, 4, i)
+    local readyAt
+    if not isPaused(q) then
+        readyAt = headReadyAt(q, now)
+    end
+    if readyAt then
+        local boost = math.floor((now - readyAt) / interval)
+        if maxBoost > 0 and boost > maxBoost then
+            boost = maxBoost
+        end
+        if not selected or q.priority + boost > maxPriority then
+            selected = q
+            maxPriority = q.priority + boost
+        end
+    end
+end
+if not selected then
+    return nil
+end
+
+return result(selected, popTask(selected))
+`)
+
+func (ps *PriorityScheduler) getTaskByAging(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	keys, args := ps.scriptArgs(snap, nil, time.Now().UnixMilli(), ps.agingInterval.Milliseconds(), ps.agingMaxBoost)
+
+	result, err := ps.redisEngine.RunScript(ctx, agingDequeueScript, keys, args...)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, queue.ErrQueueEmpty
+		}
+		return nil, fmt.Errorf("老化调度出队失败: %w", err)
+	}
+	return ps.decodeSelected(ctx, snap, result.([]interface{}))
+}
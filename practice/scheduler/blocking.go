@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetTaskBlocking 同 GetTask，所有队列都为空时阻塞等待，有任务入队后立即返回，ctx 结束时返回 ctx.Err()
+// 等待时用 BRPOP 监听未暂停队列的唤醒列表(见 queue.NotifyKey)，被唤醒后仍由 GetTask 按调度模式原子地出队，
+// 因此租户、截止时间和权重的规则与非阻塞时相同，信号被其他消费者抢先用掉时继续等待
+// 每次最多阻塞 blockTimeout，之后重新检查配置、暂停状态以及没有留下信号就入队的任务
+func (ps *PriorityScheduler) GetTaskBlocking(ctx context.Context) (*taskstruct.Task, error) {
+	for {
+		task, err := ps.GetTask(ctx)
+		switch {
+		case err == nil:
+			return task, nil
+		case errors.Is(err, ErrNoQueues):
+			if err := ps.sleep(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		case !errors.Is(err, queue.ErrQueueEmpty):
+			return nil, err
+		}
+
+		if err := ps.waitTask(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitTask 阻塞等待任一未暂停队列留下唤醒信号，超时或被唤醒时返回nil
+func (ps *PriorityScheduler) waitTask(ctx context.Context) error {
+	snap, err := ps.current(ctx)
+	if err != nil {
+		return err
+	}
+	paused, err := ps.redisEngine.SMembers(ctx, ps.redisEngine.GetPausedKey())
+	if err != nil {
+		return fmt.Errorf("读取暂停状态失败: %w", err)
+	}
+	pausedSet := make(map[string]bool, len(paused))
+	for _, name := range paused {
+		pausedSet[name] = true
+	}
+
+	keys := []string{}
+	for _, queueConfig := range snap.queues {
+		if pausedSet[queueConfig.queue.GetName()] {
+			continue
+		}
+		keys = append(keys, queue.NotifyKey(ps.redisEngine.GetName(), queueConfig.queue.GetName()))
+	}
+	if len(keys) == 0 {
+		return ps.sleep(ctx)
+	}
+
+	if _, err := ps.redisEngine.BRPop(ctx, ps.blockTimeout, keys...); err != nil {
+		if err == redis.Nil || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("阻塞等待任务失败: %w", err)
+	}
+	return nil
+}
+
+// sleep 没有可监听的队列时等待 blockTimeout
+func (ps *PriorityScheduler) sleep(ctx context.Context) error {
+	timer := time.NewTimer(ps.blockTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
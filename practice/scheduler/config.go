@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"practice/queue"
+	"practice/redisengine"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 调度器的队列配置保存在 Redis 中，所有进程共享
+// 配置变更时版本号加一，各进程在取任务前比较版本号，变化时重新读取配置
+
+// ConfigKey 保存 队列名->优先级(权重模式下为权重) 的Hash
+func ConfigKey(name string) string {
+	return fmt.Sprintf("scheduler:config:%s", name)
+}
+
+// VersionKey 配置版本号，每次修改配置加一
+func VersionKey(name string) string {
+	return fmt.Sprintf("scheduler:version:%s", name)
+}
+
+// WeightKey 权重模式下保存 队列名->当前权重 的Hash
+func WeightKey(name string) string {
+	return fmt.Sprintf("scheduler:weight:%s", name)
+}
+
+// updateQueueScript 写入队列配置并增加版本号
+var updateQueueScript = redis.NewScript(`
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return redis.call("INCR", KEYS[2])
+`)
+
+// removeQueueScript 删除队列配置和当前权重，队列存在时增加版本号并返回1
+var removeQueueScript = redis.NewScript(`
+if redis.call("HDEL", KEYS[1], ARGV[1]) == 0 then
+    return 0
+end
+redis.call("HDEL", KEYS[3], ARGV[1])
+redis.call("INCR", KEYS[2])
+return 1
+`)
+
+// UpdateQueueConfig 添加队列或修改队列的优先级，所有使用该调度器名称的进程都会生效
+func UpdateQueueConfig(ctx context.Context, redisEngine *redisengine.RedisEngine, schedulerName, queueName string, priority int) error {
+	_, err := redisEngine.RunScript(ctx, updateQueueScript, []string{ConfigKey(schedulerName), VersionKey(schedulerName)}, queueName, priority)
+	if err != nil {
+		return fmt.Errorf("更新调度器 %s 队列 %s 失败: %w", schedulerName, queueName, err)
+	}
+	return nil
+}
+
+// RemoveQueueConfig 从调度器中移除队列，队列不存在时返回 false
+func RemoveQueueConfig(ctx context.Context, redisEngine *redisengine.RedisEngine, schedulerName, queueName string) (bool, error) {
+	keys := []string{ConfigKey(schedulerName), VersionKey(schedulerName), WeightKey(schedulerName)}
+	result, err := redisEngine.RunScript(ctx, removeQueueScript, keys, queueName)
+	if err != nil {
+		return false, fmt.Errorf("移除调度器 %s 队列 %s 失败: %w", schedulerName, queueName, err)
+	}
+	return result.(int64) == 1, nil
+}
+
+type queueConfig struct {
+	queue    *queue.Queue
+	priority int
+}
+
+// snapshot 某个版本的队列配置，创建后不再修改
+type snapshot struct {
+	version     int64
+	queues      []*queueConfig // 按优先级从高到低，相同优先级按名称排序
+	byName      map[string]*queueConfig
+	totalWeight int
+}
+
+func (s *snapshot) names() []string {
+	names := make([]string, len(s.queues))
+	for i, queueConfig := range s.queues {
+		names[i] = queueConfig.queue.GetName()
+	}
+	return names
+}
+
+// loadVersion 读取配置版本号，从未配置过时为0
+func (ps *PriorityScheduler) loadVersion(ctx context.Context) (int64, error) {
+	value, err := ps.redisEngine.Get(ctx, VersionKey(ps.name))
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("读取调度器配置版本失败: %w", err)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// current 返回最新的配置，版本号没有变化时直接使用已加载的配置
+func (ps *PriorityScheduler) current(ctx context.Context) (*snapshot, error) {
+	version, err := ps.loadVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.mutex.Lock()
+	snap := ps.snapshot
+	ps.mutex.Unlock()
+	if snap != nil && snap.version == version {
+		return snap, nil
+	}
+
+	values, err := ps.redisEngine.HGetAll(ctx, ConfigKey(ps.name))
+	if err != nil {
+		return nil, fmt.Errorf("读取调度器配置失败: %w", err)
+	}
+
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	snap = &snapshot{version: version, byName: make(map[string]*queueConfig, len(values))}
+	for name, value := range values {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("解析队列 %s 的优先级失败: %w", name, err)
+		}
+		queueConfig := &queueConfig{queue: ps.queueFor(name), priority: priority}
+		snap.queues = append(snap.queues, queueConfig)
+		snap.byName[name] = queueConfig
+		snap.totalWeight += priority
+	}
+	sort.Slice(snap.queues, func(a, b int) bool {
+		if snap.queues[a].priority != snap.queues[b].priority {
+			return snap.queues[a].priority > snap.queues[b].priority
+		}
+		return snap.queues[a].queue.GetName() < snap.queues[b].queue.GetName()
+	})
+
+	if ps.snapshot != nil && ps.snapshot.version != version {
+		ps.logger.Info("scheduler config reloaded", "scheduler", ps.name, "version", version, "queues", len(snap.queues))
+	}
+	ps.snapshot = snap
+	return snap, nil
+}
+
+// queueFor 返回队列对象，优先使用 AddQueue 传入的队列，其他进程添加的队列按 WithQueueOptions 创建
+// 调用方需持有 mutex
+func (ps *PriorityScheduler) queueFor(name string) *queue.Queue {
+	if q, ok := ps.queues[name]; ok {
+		return q
+	}
+	q := queue.NewQueue(name, ps.redisEngine, ps.queueOptions...)
+	ps.queues[name] = q
+	return q
+}
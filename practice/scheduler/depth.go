@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// depthDequeueScript 按队列的积压情况选择队列，选择和出队在一个脚本中完成
+// ARGV[2] 为调度模式：
+//   - longest: 任务数最多的队列，任务数相同时按配置顺序
+//   - oldest: 队首任务 ready_at 最早的队列，相同时按配置顺序
+//   - lottery: 以权重为概率随机选择，ARGV[4] 为 [0,1) 的随机数
+//
+// ARGV[3] 为当前毫秒时间，其余 KEYS、ARGV 的格式见 queueLua，只有未暂停且有任务的队列参与选择
+// 返回格式同 weightDequeueScript
+var depthDequeueScript = redis.NewScript(queueLua + `
+local mode = ARGV[2]
+local now = tonumber(ARGV[3])
+
+local selected
+local best
+local candidates = {}
+local total = 0
+for i = 1, queueCount(3) do
+    local q = queueAt(3, 4, i)
+    if not isPaused(q) then
+        if mode == "longest" then
+            local depth = queueDepth(q)
+            if depth > 0 and (not best or depth > best) then
+                selected = q
+                best = depth
+            end
+        elseif mode == "oldest" then
+            local readyAt = headReadyAt(q, now)
+            if readyAt and (not best or readyAt < best) then
+                selected = q
+                best = readyAt
+            end
+        elseif q.priority > 0 and hasTask(q) then
+            table.insert(candidates, q)
+            total = total + q.priority
+        end
+    end
+end
+
+if mode == "lottery" and total > 0 then
+    local ticket = tonumber(ARGV[4]) * total
+    for _, q in ipairs(candidates) do
+        selected = q
+        ticket = ticket - q.priority
+        if ticket < 0 then
+            break
+        end
+    end
+end
+if not selected then
+    return nil
+end
+
+return result(selected, popTask(selected))
+`)
+
+// depthModes 调度模式在脚本中的名称
+var depthModes = map[SchedulerMode]string{
+	SchedulerLongestQueueFirst: "longest",
+	SchedulerOldestFirst:       "oldest",
+	SchedulerLottery:           "lottery",
+}
+
+func (ps *PriorityScheduler) getTaskByDepth(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	keys, args := ps.scriptArgs(snap, nil, depthModes[ps.mode], time.Now().UnixMilli(), rand.Float64())
+
+	result, err := ps.redisEngine.RunScript(ctx, depthDequeueScript, keys, args...)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, queue.ErrQueueEmpty
+		}
+		return nil, fmt.Errorf("%s 调度出队失败: %w", ps.mode, err)
+	}
+	return ps.decodeSelected(ctx, snap, result.([]interface{}))
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"practice/queue"
+	"practice/taskstruct"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// edfDequeueScript 最早截止时间优先：比较每个未暂停队列截止时间ZSet中最早的任务，取出截止时间最早的一个
+// 截止时间相同时按配置顺序选择；所有队列都没有带截止时间的任务时，按配置顺序从第一个有任务的队列出队
+// 只有本模式按截止时间出队，其他模式和直接消费队列时带截止时间的任务仍按入队顺序出队
+// KEYS、ARGV 的格式见 queueLua
+// 返回格式同 weightDequeueScript
+var edfDequeueScript = redis.NewScript(queueLua + `
+while true do
+    local selected
+    local earliest
+    for i = 1, queueCount(3) do
+        local q = queueAt(3, 1, i)
+        if not isPaused(q) then
+            local head = redis.call("ZRANGE", q.deadline, 0, 0, "WITHSCORES")
+            if #head > 0 and (not earliest or tonumber(head[2]) < earliest) then
+                selected = q
+                earliest = tonumber(head[2])
+            end
+        end
+    end
+    if not selected then
+        break
+    end
+    -- 取到已取消任务的索引时重新比较，已取消任务的索引在 popDeadline 中被丢弃
+    local taskID = popDeadline(selected)
+    if taskID then
+        return result(selected, taskID)
+    end
+end
+
+for i = 1, queueCount(3) do
+    local q = queueAt(3, 1, i)
+    if not isPaused(q) then
+        local taskID = popTask(q)
+        if taskID then
+            return result(q, taskID)
+        end
+    end
+end
+return nil
+`)
+
+func (ps *PriorityScheduler) getTaskByDeadline(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	keys, args := ps.scriptArgs(snap, nil)
+
+	result, err := ps.redisEngine.RunScript(ctx, edfDequeueScript, keys, args...)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, queue.ErrQueueEmpty
+		}
+		return nil, fmt.Errorf("截止时间调度出队失败: %w", err)
+	}
+	return ps.decodeSelected(ctx, snap, result.([]interface{}))
+}
@@ -0,0 +1,10 @@
+package scheduler
+
+import "errors"
+
+var (
+	// ErrNoQueues 调度器没有注册任何队列
+	ErrNoQueues = errors.New("没有可用队列")
+	// ErrInvalidMode 调度模式不存在
+	ErrInvalidMode = errors.New("无效模式")
+)
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"practice/queue"
+	"practice/taskstruct"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fairDequeueScript 多租户公平调度：按配置顺序选择第一个有任务的未暂停队列，
+// 队列内按赤字轮询在租户之间轮转，没有租户的任务作为租户 "" 参与轮询，队列内的轮询规则与其他模式相同
+// 租户权重见 queue.SetTenantWeight；KEYS、ARGV 的格式见 queueLua，返回格式同 weightDequeueScript
+var fairDequeueScript = redis.NewScript(queueLua + `
+for i = 1, queueCount(3) do
+    local q = queueAt(3, 1, i)
+    if not isPaused(q) then
+        local taskID = popTask(q)
+        if taskID then
+            return result(q, taskID)
+        end
+    end
+end
+return nil
+`)
+
+func (ps *PriorityScheduler) getTaskFairly(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	keys, args := ps.scriptArgs(snap, nil)
+
+	result, err := ps.redisEngine.RunScript(ctx, fairDequeueScript, keys, args...)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, queue.ErrQueueEmpty
+		}
+		return nil, fmt.Errorf("公平调度出队失败: %w", err)
+	}
+	return ps.decodeSelected(ctx, snap, result.([]interface{}))
+}
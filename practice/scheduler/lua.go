@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// queueLua 调度脚本共用的 Lua 函数，拼接在各调度脚本之前
+// 调度脚本的 KEYS 依次为 任务Hash、暂停集合、租户权重、脚本自己的key，之后每个队列为 列表、截止时间ZSet、租户环、租户赤字；
+// ARGV 依次为 任务key前缀、脚本自己的参数，之后每个队列为 队列名、优先级(权重)
+// 租户子列表与 queue.PopTenantLua 相同，由租户环中的租户拼出key
+var queueLua = queue.PopTenantLua + `
+-- queueAt 第 i 个队列的key和配置，keyOffset、argOffset 为脚本固定key和参数的个数
+local function queueAt(keyOffset, argOffset, i)
+    local base = keyOffset + (i - 1) * 4
+    local argBase = argOffset + (i - 1) * 2
+    return {
+        list = KEYS[base + 1], deadline = KEYS[base + 2], ring = KEYS[base + 3], deficit = KEYS[base + 4],
+        name = ARGV[argBase + 1], priority = tonumber(ARGV[argBase + 2]),
+    }
+end
+
+local function queueCount(keyOffset)
+    return (#KEYS - keyOffset) / 4
+end
+
+local function isPaused(q)
+    return redis.call("SISMEMBER", KEYS[2], q.name) == 1
+end
+
+-- hasTask 队列的列表或租户子列表中是否有任务，带截止时间的任务也在其中
+local function hasTask(q)
+    return redis.call("LLEN", q.list) > 0 or redis.call("LLEN", q.ring) > 0
+end
+
+-- peekTask 下一个会出队的任务ID，不出队
+-- 与 popTenant 相同，租户环头部的租户先出队，列表只在环中没有其他租户或轮到租户 "" 时出队
+local function peekTask(q)
+    local tenant = redis.call("LINDEX", q.ring, 0)
+    if tenant and tenant ~= "" then
+        local taskID = redis.call("LINDEX", KEYS[1] .. ":tenant:" .. q.name .. ":" .. tenant, -1)
+        if taskID then
+            return taskID
+        end
+    end
+    return redis.call("LINDEX", q.list, -1) or nil
+end
+
+-- headReadyAt 队首任务的 ready_at，没有任务返回nil，任务体丢失或没有 ready_at 时返回 now
+local function headReadyAt(q, now)
+    local headID = peekTask(q)
+    if not headID then
+        return nil
+    end
+    local headData = redis.call("HGET", KEYS[1], ARGV[1] .. headID)
+    if headData then
+        local ok, head = pcall(cjson.decode, headData)
+        if ok and type(head) == "table" and type(head["ready_at"]) == "number" then
+            return math.min(now, head["ready_at"])
+        end
+    end
+    return now
+end
+
+-- queueDepth 列表和所有租户子列表中的任务数之和
+local function queueDepth(q)
+    local depth = redis.call("LLEN", q.list)
+    for _, tenant in ipairs(redis.call("LRANGE", q.ring, 0, -1)) do
+        if tenant ~= "" then
+            depth = depth + redis.call("LLEN", KEYS[1] .. ":tenant:" .. q.name .. ":" .. tenant)
+        end
+    end
+    return depth
+end
+
+-- popTask 按赤字轮询从列表和租户子列表出队，列表中的任务作为租户 "" 参与轮询
+-- 带截止时间的任务同样按入队顺序出队，出队后从截止时间ZSet中移除
+local function popTask(q)
+    local taskID = popTenant(KEYS[1], q.name, q.list, q.ring, q.deficit, KEYS[3], true)
+    if taskID then
+        redis.call("ZREM", q.deadline, taskID)
+    end
+    return taskID
+end
+
+-- popDeadline 从截止时间ZSet中取出最早的任务，并从它所在的列表或租户子列表中移除
+-- 不在任何列表中的ID(已被取消)直接丢弃并返回nil，ZSet为空时也返回nil
+local function popDeadline(q)
+    local popped = redis.call("ZPOPMIN", q.deadline)
+    if #popped == 0 then
+        return nil
+    end
+    local taskID = popped[1]
+    if redis.call("LREM", q.list, 1, taskID) > 0 then
+        return taskID
+    end
+    local taskData = redis.call("HGET", KEYS[1], ARGV[1] .. taskID)
+    local tenant = taskData and cjson.decode(taskData)["tenant"]
+    if type(tenant) == "string" and tenant ~= "" then
+        local subKey = KEYS[1] .. ":tenant:" .. q.name .. ":" .. tenant
+        if redis.call("LREM", subKey, 1, taskID) > 0 then
+            if redis.call("LLEN", subKey) == 0 then
+                redis.call("LREM", q.ring, 0, tenant)
+                redis.call("HDEL", q.deficit, tenant)
+            end
+            return taskID
+        end
+    end
+    return nil
+end
+
+-- result 取出任务体，返回 {队列名, 任务ID, 0, 任务体}，任务体丢失时不含任务体
+-- 租户环中只剩已取消任务的租户时 taskID 可能为空，此时返回nil
+local function result(q, taskID)
+    if not taskID then
+        return nil
+    end
+    local taskKey = ARGV[1] .. taskID
+    local taskData = redis.call("HGET", KEYS[1], taskKey)
+    if not taskData then
+        return {q.name, taskID, "0"}
+    end
+    redis.call("HDEL", KEYS[1], taskKey)
+    return {q.name, taskID, "0", taskData}
+end
+`
+
+// scriptArgs 按 queueLua 的格式拼出调度脚本的 KEYS 和 ARGV，extraKeys、extraArgs 为脚本自己的key和参数
+func (ps *PriorityScheduler) scriptArgs(snap *snapshot, extraKeys []string, extraArgs ...interface{}) ([]string, []interface{}) {
+	namespace := ps.redisEngine.GetName()
+	keys := append([]string{namespace, ps.redisEngine.GetPausedKey(), queue.TenantWeightsKey(namespace)}, extraKeys...)
+	args := append([]interface{}{taskstruct.TaskKeyPrefix}, extraArgs...)
+	for _, queueConfig := range snap.queues {
+		q := queueConfig.queue
+		keys = append(keys, q.GetQueueKey(), q.GetDeadlineKey(), q.GetTenantsKey(), q.GetDeficitKey())
+		args = append(args, q.GetName(), queueConfig.priority)
+	}
+	return keys, args
+}
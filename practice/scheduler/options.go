@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"practice/logging"
+	"practice/queue"
+	"time"
+)
+
+// Recorder 接收调度事件，用于统计指标，metrics.Metrics 实现了该接口
+type Recorder interface {
+	QueueSelected(scheduler, queue string)
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) QueueSelected(scheduler, queue string) {}
+
+// Option 调度器的可选配置，在构造函数中传入
+type Option func(*PriorityScheduler)
+
+func WithRecorder(recorder Recorder) Option {
+	return func(ps *PriorityScheduler) {
+		ps.recorder = recorder
+	}
+}
+
+// WithLogger 设置日志，默认不输出
+func WithLogger(logger logging.Logger) Option {
+	return func(ps *PriorityScheduler) {
+		ps.logger = logger
+	}
+}
+
+// WithQueueOptions 为其他进程添加到配置中的队列创建队列对象时使用的配置
+func WithQueueOptions(opts ...queue.Option) Option {
+	return func(ps *PriorityScheduler) {
+		ps.queueOptions = append(ps.queueOptions, opts...)
+	}
+}
+
+// WithBlockTimeout GetTaskBlocking 每次阻塞等待的最长时间，超时后重新检查配置和暂停状态，默认1秒
+func WithBlockTimeout(timeout time.Duration) Option {
+	return func(ps *PriorityScheduler) {
+		if timeout > 0 {
+			ps.blockTimeout = timeout
+		}
+	}
+}
+
+// WithAging 老化模式的参数，队首任务每等待 interval 队列优先级加一，最多加 maxBoost(0表示不限)
+// 默认每10秒加一，不限上限
+func WithAging(interval time.Duration, maxBoost int) Option {
+	return func(ps *PriorityScheduler) {
+		if interval > 0 {
+			ps.agingInterval = interval
+		}
+		ps.agingMaxBoost = maxBoost
+	}
+}
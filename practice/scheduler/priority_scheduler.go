@@ -6,225 +6,236 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"practice/logging"
 	"practice/queue"
 	"practice/redisengine"
 	"practice/taskstruct"
-	"strconv"
-)
-
-type queueConfig struct {
-	queue *queue.Queue
+	"sync"
+	"time"
 
-	priority      int
-	weightCurrent int
-	totalTask     int
-}
+	"github.com/redis/go-redis/v9"
+)
 
 type SchedulerMode string
 
 const (
 	SchedulerPriority SchedulerMode = "priority"
 	SchedulerWeight   SchedulerMode = "weight"
+	SchedulerAging    SchedulerMode = "aging" // 优先级随队首任务的等待时间提升，避免低优先级队列饿死
+	SchedulerEDF      SchedulerMode = "edf"   // 在所有队列中取截止时间最早的任务
+	SchedulerFair     SchedulerMode = "fair"  // 队列内按租户赤字轮询，每个有任务的租户按权重分得处理机会
+
+	SchedulerLongestQueueFirst SchedulerMode = "longest" // 优先处理积压最多的队列
+	SchedulerOldestFirst       SchedulerMode = "oldest"  // 优先处理队首任务等待最久的队列
+	SchedulerLottery           SchedulerMode = "lottery" // 以权重为概率随机选择队列
 )
 
 type PriorityScheduler struct {
 	name string
 	mode SchedulerMode
 
-	redisEngine    *redisengine.RedisEngine
-	queueConfigMap map[string]*queueConfig
+	redisEngine  *redisengine.RedisEngine
+	queueOptions []queue.Option
+
+	mutex    sync.Mutex
+	queues   map[string]*queue.Queue // 已创建的队列对象
+	snapshot *snapshot               // 最近一次加载的配置
 
-	totalWeight int
+	agingInterval time.Duration // 老化模式下优先级加一所需的等待时间
+	agingMaxBoost int           // 老化模式下优先级最多提升多少，0表示不限
+	blockTimeout  time.Duration // GetTaskBlocking 每次阻塞等待的最长时间
+
+	logger   logging.Logger
+	recorder Recorder
 }
 
-func NewPriorityScheduler(mode SchedulerMode, name string, redisEngine *redisengine.RedisEngine) *PriorityScheduler {
-	return &PriorityScheduler{
-		name:           name,
-		mode:           mode,
-		queueConfigMap: make(map[string]*queueConfig),
-		redisEngine:    redisEngine,
-		totalWeight:    0,
-	}
+func NewPriorityScheduler(mode SchedulerMode, name string, redisEngine *redisengine.RedisEngine, opts ...Option) *PriorityScheduler {
+	ps := &PriorityScheduler{
+		name:          name,
+		mode:          mode,
+		redisEngine:   redisEngine,
+		queues:        make(map[string]*queue.Queue),
+		agingInterval: 10 * time.Second,
+		blockTimeout:  time.Second,
+		logger:        logging.Nop{},
+		recorder:      nopRecorder{},
+	}
+	for _, opt := range opts {
+		opt(ps)
+	}
+	return ps
 }
 
+// GetTask 按调度模式取一个任务，所有队列都为空时返回 queue.ErrQueueEmpty
 func (ps *PriorityScheduler) GetTask(ctx context.Context) (*taskstruct.Task, error) {
+	snap, err := ps.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.queues) == 0 {
+		return nil, ErrNoQueues
+	}
 	switch ps.mode {
 	case SchedulerWeight:
-		return ps.getTaskByWeight(ctx)
+		return ps.getTaskByWeight(ctx, snap)
 	case SchedulerPriority:
-		return ps.getTaskByPriority(ctx)
-	}
-	return nil, fmt.Errorf("无效模式 %s", ps.mode)
+		return ps.getTaskByPriority(ctx, snap)
+	case SchedulerAging:
+		return ps.getTaskByAging(ctx, snap)
+	case SchedulerEDF:
+		return ps.getTaskByDeadline(ctx, snap)
+	case SchedulerFair:
+		return ps.getTaskFairly(ctx, snap)
+	case SchedulerLongestQueueFirst, SchedulerOldestFirst, SchedulerLottery:
+		return ps.getTaskByDepth(ctx, snap)
+	}
+	return nil, fmt.Errorf("%w %s", ErrInvalidMode, ps.mode)
 }
 
-func (ps *PriorityScheduler) getTaskByPriority(ctx context.Context) (*taskstruct.Task, error) {
-	queueKeys, err := ps.redisEngine.ZRevRangeByScore(ctx, ps.getSchedulerKey(), "+inf", "-inf", 0, -1)
-	if err != nil {
-		return nil, err
-	}
-	for _, queueKey := range queueKeys {
-		queueConfig, ok := ps.queueConfigMap[queueKey]
-		if !ok {
-			return nil, fmt.Errorf("%s not found", queueKey)
-		}
+// DequeueTask 同 GetTask，使调度器和队列一样可以作为 worker 的任务来源
+func (ps *PriorityScheduler) DequeueTask(ctx context.Context) (*taskstruct.Task, error) {
+	return ps.GetTask(ctx)
+}
+
+func (ps *PriorityScheduler) getTaskByPriority(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	for _, queueConfig := range snap.queues {
 		task, err := queueConfig.queue.DequeueTask(ctx)
 		if err != nil {
+			if errors.Is(err, queue.ErrQueueEmpty) {
+				continue
+			}
 			return nil, err
 		}
-		if task != nil {
-			return task, nil
-		}
+		ps.selected(queueConfig.queue.GetName(), task)
+		return task, nil
 	}
 
-	return nil, fmt.Errorf("没有任务")
+	return nil, queue.ErrQueueEmpty
 }
 
-func (ps *PriorityScheduler) AddQueue(ctx context.Context, queue *queue.Queue, priority int) error {
-	schedulerKey := ps.getSchedulerKey()
-	queueKey := ps.getQueueKey(queue)
-
-	queueConfig := &queueConfig{
-		queue:         queue,
-		priority:      priority,
-		weightCurrent: priority,
-		totalTask:     0,
-	}
-	ps.queueConfigMap[queueKey] = queueConfig
-
-	switch ps.mode {
-	case SchedulerPriority:
-		score := float64(queueConfig.priority)
-		err := ps.redisEngine.ZAdd(ctx, schedulerKey, score, queueKey)
-		if err != nil {
-			return err
-		}
-		return nil
-	case SchedulerWeight:
-		ps.totalWeight += priority
-		return nil
-	}
-	return fmt.Errorf("无效模式 %s", ps.mode)
+// selected 记录选中的队列
+func (ps *PriorityScheduler) selected(queueName string, task *taskstruct.Task) {
+	ps.logger.Debug("queue selected", "scheduler", ps.name, "mode", ps.mode, "queue", queueName, "task_id", task.ID, "type", task.Type)
+	ps.recorder.QueueSelected(ps.name, queueName)
 }
 
-func (ps *PriorityScheduler) getQueueKey(queue *queue.Queue) string {
-	return fmt.Sprintf("%s:%s", ps.name, queue.GetQueueKey())
-}
+// AddQueue 把队列加入调度器，配置保存在 Redis 中，之后本进程使用传入的队列对象出队
+// 权重模式下 priority 即为权重
+func (ps *PriorityScheduler) AddQueue(ctx context.Context, q *queue.Queue, priority int) error {
+	ps.mutex.Lock()
+	ps.queues[q.GetName()] = q
+	ps.mutex.Unlock()
 
-func (ps *PriorityScheduler) getSchedulerKey() string {
-	return fmt.Sprintf("scheduler:%s", ps.name)
+	return ps.UpdateQueue(ctx, q.GetName(), priority)
 }
 
-func (ps *PriorityScheduler) getWeightKey() string {
-	return fmt.Sprintf("scheduler:weight:%s", ps.name)
+// UpdateQueue 添加队列或修改队列的优先级，所有进程在下次取任务时生效
+func (ps *PriorityScheduler) UpdateQueue(ctx context.Context, queueName string, priority int) error {
+	return UpdateQueueConfig(ctx, ps.redisEngine, ps.name, queueName, priority)
 }
 
-// 加权轮询算法获取任务
-func (ps *PriorityScheduler) getTaskByWeight(ctx context.Context) (*taskstruct.Task, error) {
-	weightKey := ps.getWeightKey()
+// RemoveQueue 从调度器中移除队列，队列中的任务不受影响
+func (ps *PriorityScheduler) RemoveQueue(ctx context.Context, queueName string) error {
+	_, err := RemoveQueueConfig(ctx, ps.redisEngine, ps.name, queueName)
+	return err
+}
 
-	fieldIncrements := make(map[string]int64)
-	for queueKey, queueConfig := range ps.queueConfigMap {
-		fieldIncrements[queueKey] = int64(queueConfig.priority)
+// QueueNames 当前配置中的队列名称，按优先级从高到低
+// 还没有取过任务时也会加载配置，读取失败时返回最近一次加载的配置中的名称
+func (ps *PriorityScheduler) QueueNames() []string {
+	snap, err := ps.current(context.Background())
+	if err == nil {
+		return snap.names()
 	}
+	ps.logger.Error("load scheduler config failed", "scheduler", ps.name, "error", err)
 
-	_, err := ps.redisEngine.HIncrByBatch(ctx, weightKey, fieldIncrements)
-	if err != nil {
-		return nil, fmt.Errorf("批量更新权重失败: %v", err)
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.snapshot == nil {
+		return nil
 	}
+	return ps.snapshot.names()
+}
 
-	currentWeights, err := ps.redisEngine.HGetAll(ctx, weightKey)
-	if err != nil {
-		return nil, err
-	}
+func (ps *PriorityScheduler) getWeightKey() string {
+	return WeightKey(ps.name)
+}
 
-	selectedQueue, err := ps.selectMaxWeightQueue(currentWeights)
-	if err != nil {
-		return nil, err
-	}
+// weightDequeueScript 平滑加权轮询，选择、出队和调整权重在一个脚本中完成，多个进程并发取任务时分配比例保持准确
+// 只有未暂停且非空的队列参与本轮选择：参与的队列当前权重加上各自权重，选出当前权重最大的队列出队，再减去参与队列的权重之和
+// KEYS[4] 为当前权重Hash，其余 KEYS、ARGV 的格式见 queueLua
+// 返回 {队列名, 任务ID, 0, 任务体}，任务体丢失时不含任务体，所有队列都为空返回nil
+var weightDequeueScript = redis.NewScript(queueLua + `
+local candidates = {}
+local total = 0
+for i = 1, queueCount(4) do
+    local q = queueAt(4, 1, i)
+    if q.priority > 0 and not isPaused(q) and hasTask(q) then
+        table.insert(candidates, q)
+        total = total + q.priority
+    end
+end
+if #candidates == 0 then
+    return nil
+end
+
+local currents = {}
+local order = {}
+for i, q in ipairs(candidates) do
+    currents[i] = redis.call("HINCRBY", KEYS[4], q.name, q.priority)
+    order[i] = i
+end
+table.sort(order, function(a, b)
+    if currents[a] ~= currents[b] then
+        return currents[a] > currents[b]
+    end
+    return a < b
+end)
+
+-- 按当前权重从大到小尝试出队，队列中只剩已取消任务的租户时取不到任务，继续尝试下一个
+for _, i in ipairs(order) do
+    local taskID = popTask(candidates[i])
+    if taskID then
+        redis.call("HINCRBY", KEYS[4], candidates[i].name, -total)
+        return result(candidates[i], taskID)
+    end
+end
+
+-- 没有取到任务时撤销本轮加上的权重
+for _, q in ipairs(candidates) do
+    redis.call("HINCRBY", KEYS[4], q.name, -q.priority)
+end
+return nil
+`)
 
-	queueConfig, ok := ps.queueConfigMap[selectedQueue]
-	if !ok {
-		return nil, fmt.Errorf("队列配置不存在: %s", selectedQueue)
-	}
+// 加权轮询算法获取任务
+func (ps *PriorityScheduler) getTaskByWeight(ctx context.Context, snap *snapshot) (*taskstruct.Task, error) {
+	keys, args := ps.scriptArgs(snap, []string{ps.getWeightKey()})
 
-	task, err := queueConfig.queue.DequeueTask(ctx)
+	result, err := ps.redisEngine.RunScript(ctx, weightDequeueScript, keys, args...)
 	if err != nil {
-		return nil, err
-	}
-
-	if task != nil {
-		_, err = ps.redisEngine.HIncrBy(ctx, weightKey, selectedQueue, -int64(ps.totalWeight))
-		if err != nil {
-			return nil, fmt.Errorf("减少权重失败: %v", err)
+		if err == redis.Nil {
+			return nil, queue.ErrQueueEmpty
 		}
-		return task, nil
+		return nil, fmt.Errorf("加权轮询出队失败: %w", err)
 	}
 
-	return ps.fallbackToOtherQueues(ctx, selectedQueue)
+	return ps.decodeSelected(ctx, snap, result.([]interface{}))
 }
 
-// 选择权重最高的队列
-func (ps *PriorityScheduler) selectMaxWeightQueue(currentWeights map[string]string) (string, error) {
-	var selectedQueue string
-	var maxWeight int64 = -1
-
-	for queueKey, weightStr := range currentWeights {
-		// 检查队列是否还在配置中
-		if _, exists := ps.queueConfigMap[queueKey]; !exists {
-			continue
-		}
-
-		weight, err := strconv.ParseInt(weightStr, 10, 64)
-		if err != nil {
-			return "", fmt.Errorf("解析权重失败: %v", err)
-		}
-
-		if weight > maxWeight {
-			maxWeight = weight
-			selectedQueue = queueKey
-		}
-	}
-
-	if selectedQueue == "" {
-		return "", fmt.Errorf("没有可用队列")
+// decodeSelected 解析调度脚本返回的 {队列名, 任务ID, 到期时间, 任务体}
+func (ps *PriorityScheduler) decodeSelected(ctx context.Context, snap *snapshot, values []interface{}) (*taskstruct.Task, error) {
+	queueName := values[0].(string)
+	queueConfig, ok := snap.byName[queueName]
+	if !ok {
+		return nil, fmt.Errorf("调度器 %s 中没有队列 %s", ps.name, queueName)
 	}
-
-	return selectedQueue, nil
-}
-
-func (ps *PriorityScheduler) fallbackToOtherQueues(ctx context.Context, excludeQueue string) (*taskstruct.Task, error) {
-	weightKey := ps.getWeightKey()
-	currentWeights, err := ps.redisEngine.HGetAll(ctx, weightKey)
+	task, err := queueConfig.queue.DecodeDequeued(ctx, values[1:])
 	if err != nil {
 		return nil, err
 	}
-
-	for queueKey := range currentWeights {
-		if queueKey == excludeQueue {
-			continue
-		}
-
-		queueConfig, ok := ps.queueConfigMap[queueKey]
-		if !ok {
-			continue
-		}
-
-		task, err := queueConfig.queue.DequeueTask(ctx)
-		if err != nil {
-			continue
-		}
-
-		if task != nil {
-			_, err = ps.redisEngine.HIncrBy(ctx, weightKey, queueKey, -int64(ps.totalWeight))
-			if err != nil {
-				return nil, fmt.Errorf("减少权重失败: %v", err)
-			}
-
-			queueConfig.totalTask++
-			return task, nil
-		}
-	}
-
-	return nil, fmt.Errorf("所有队列都没有任务")
+	ps.selected(queueName, task)
+	return task, nil
 }
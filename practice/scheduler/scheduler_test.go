@@ -0,0 +1,385 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/taskstruct"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// enqueue 向队列放入 count 个任务
+func enqueue(t *testing.T, q *queue.Queue, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if err := q.EnqueueTask(context.Background(), taskstruct.NewTask("test", nil, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestQueueNamesBeforeFirstTask(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	if err := UpdateQueueConfig(ctx, engine, "main", "low", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateQueueConfig(ctx, engine, "main", "high", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewPriorityScheduler(SchedulerPriority, "main", engine)
+	if names := ps.QueueNames(); !reflect.DeepEqual(names, []string{"high", "low"}) {
+		t.Fatalf("QueueNames = %v, want [high low]", names)
+	}
+}
+
+func TestWeightRatioUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	ps := NewPriorityScheduler(SchedulerWeight, "main", engine)
+	heavy := queue.NewQueue("heavy", engine)
+	light := queue.NewQueue("light", engine)
+	if err := ps.AddQueue(ctx, heavy, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddQueue(ctx, light, 1); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, heavy, 100)
+	enqueue(t, light, 100)
+
+	// 多个 goroutine 并发取任务，每轮4个任务中 heavy 占3个
+	const workers, total = 8, 80
+	var mutex sync.Mutex
+	counts := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < total/workers; i++ {
+				task, err := ps.GetTask(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mutex.Lock()
+				counts[task.Queue]++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counts["heavy"] != 60 || counts["light"] != 20 {
+		t.Fatalf("counts = %v, want heavy 60 and light 20", counts)
+	}
+}
+
+func TestWeightSkipsQueueWithOnlyStaleTenants(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	ps := NewPriorityScheduler(SchedulerWeight, "main", engine)
+	stale := queue.NewQueue("stale", engine)
+	other := queue.NewQueue("other", engine)
+	if err := ps.AddQueue(ctx, stale, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddQueue(ctx, other, 1); err != nil {
+		t.Fatal(err)
+	}
+	// 租户环中的租户已经没有任务，例如任务被取消后
+	if _, err := engine.RunScript(ctx, redis.NewScript(`return redis.call("RPUSH", KEYS[1], "ghost")`), []string{stale.GetTenantsKey()}); err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, other, 1)
+
+	task, err := ps.GetTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Queue != "other" {
+		t.Fatalf("task queue = %s, want other", task.Queue)
+	}
+}
+
+func TestAgingPromotesWaitingQueue(t *testing.T) {
+	for _, tc := range []struct {
+		maxBoost int
+		want     string
+	}{
+		{maxBoost: 0, want: "low"},  // 等待足够久后低优先级队列的有效优先级超过高优先级队列
+		{maxBoost: 1, want: "high"}, // 提升受上限约束
+	} {
+		ctx := context.Background()
+		_, engine := testredis.New(t)
+		ps := NewPriorityScheduler(SchedulerAging, "main", engine, WithAging(10*time.Millisecond, tc.maxBoost))
+		high := queue.NewQueue("high", engine)
+		low := queue.NewQueue("low", engine)
+		if err := ps.AddQueue(ctx, high, 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := ps.AddQueue(ctx, low, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		enqueue(t, low, 1)
+		time.Sleep(100 * time.Millisecond)
+		enqueue(t, high, 1)
+
+		task, err := ps.GetTask(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Queue != tc.want {
+			t.Fatalf("maxBoost %d: task queue = %s, want %s", tc.maxBoost, task.Queue, tc.want)
+		}
+	}
+}
+
+// 最早截止时间优先在所有队列中按截止时间出队，取出租户任务时清理租户环，已取消任务的索引被跳过
+func TestEDFOrdersByDeadline(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	ps := NewPriorityScheduler(SchedulerEDF, "main", engine)
+	first := queue.NewQueue("first", engine)
+	second := queue.NewQueue("second", engine)
+	if err := ps.AddQueue(ctx, first, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddQueue(ctx, second, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := taskstruct.NewTask("test", nil, 3)
+	late := taskstruct.NewTask("test", nil, 3)
+	late.Tenant = "acme"
+	late.Deadline = time.Now().Add(time.Hour)
+	soon := taskstruct.NewTask("test", nil, 3)
+	soon.Deadline = time.Now().Add(time.Minute)
+	for _, task := range []*taskstruct.Task{plain, late} {
+		if err := first.EnqueueTask(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := second.EnqueueTask(ctx, soon); err != nil {
+		t.Fatal(err)
+	}
+	// 只在索引中的ID相当于已被取消的任务
+	if err := engine.ZAdd(ctx, first.GetDeadlineKey(), 0, "cancelled"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []*taskstruct.Task{soon, late, plain} {
+		got, err := ps.GetTask(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != want.ID {
+			t.Fatalf("dequeued %s, want %s", got.ID, want.ID)
+		}
+	}
+	if tenants, err := first.Tenants(ctx); err != nil || len(tenants) != 0 {
+		t.Fatalf("tenants = %v (%v), want none", tenants, err)
+	}
+	if _, err := ps.GetTask(ctx); !errors.Is(err, queue.ErrQueueEmpty) {
+		t.Fatalf("err = %v, want ErrQueueEmpty", err)
+	}
+}
+
+// 阻塞等待时入队的租户任务被唤醒后按权重模式的脚本出队
+func TestBlockingWakesForTenantTask(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, engine := testredis.New(t)
+	ps := NewPriorityScheduler(SchedulerWeight, "main", engine, WithBlockTimeout(5*time.Second))
+	heavy := queue.NewQueue("heavy", engine)
+	light := queue.NewQueue("light", engine)
+	if err := ps.AddQueue(ctx, heavy, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddQueue(ctx, light, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	type dequeued struct {
+		task *taskstruct.Task
+		err  error
+	}
+	got := make(chan dequeued, 1)
+	start := time.Now()
+	go func() {
+		task, err := ps.GetTaskBlocking(ctx)
+		got <- dequeued{task, err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	task := taskstruct.NewTask("test", nil, 3)
+	task.Tenant = "acme"
+	task.Deadline = time.Now().Add(time.Hour)
+	if err := light.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	result := <-got
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.task.ID != task.ID {
+		t.Fatalf("dequeued %s, want %s", result.task.ID, task.ID)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("woke after %v, want before the block timeout", elapsed)
+	}
+	if tenants, err := light.Tenants(ctx); err != nil || len(tenants) != 0 {
+		t.Fatalf("tenants = %v (%v), want none", tenants, err)
+	}
+	if size, err := engine.ZCard(ctx, light.GetDeadlineKey()); err != nil || size != 0 {
+		t.Fatalf("deadline index size = %d (%v), want 0", size, err)
+	}
+	// 只有 light 有任务，权重模式出队后它的当前权重为 1-1=0，heavy 未参与
+	weights, err := engine.HGetAll(ctx, ps.getWeightKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weights["light"] != "0" || weights["heavy"] != "" {
+		t.Fatalf("current weights = %v, want light selected by the weight script", weights)
+	}
+}
+
+// enqueueTenant 向队列放入 count 个属于 tenant 的任务
+func enqueueTenant(t *testing.T, q *queue.Queue, tenant string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		task := taskstruct.NewTask("test", nil, 3)
+		task.Tenant = tenant
+		if err := q.EnqueueTask(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// addQueues 按 names 的顺序把队列加入调度器，优先级取自 weights
+func addQueues(t *testing.T, ps *PriorityScheduler, engine *redisengine.RedisEngine, weights map[string]int, names ...string) map[string]*queue.Queue {
+	t.Helper()
+	queues := make(map[string]*queue.Queue)
+	for _, name := range names {
+		queues[name] = queue.NewQueue(name, engine)
+		if err := ps.AddQueue(context.Background(), queues[name], weights[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return queues
+}
+
+// selection 按顺序记录调度器选中的队列
+type selection struct {
+	recorded []string
+}
+
+func (s *selection) QueueSelected(scheduler, queue string) {
+	s.recorded = append(s.recorded, queue)
+}
+
+func TestLongestCountsTenantLists(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	selected := &selection{}
+	ps := NewPriorityScheduler(SchedulerLongestQueueFirst, "main", engine, WithRecorder(selected))
+	queues := addQueues(t, ps, engine, map[string]int{"plain": 2, "tenants": 1}, "plain", "tenants")
+	enqueue(t, queues["plain"], 2)
+	enqueue(t, queues["tenants"], 1)
+	enqueueTenant(t, queues["tenants"], "acme", 2)
+
+	if _, err := ps.GetTask(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if selected.recorded[0] != "tenants" {
+		t.Fatalf("selected %s, want tenants with 3 tasks counting tenant lists", selected.recorded[0])
+	}
+}
+
+func TestOldestPicksEarliestHead(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	selected := &selection{}
+	ps := NewPriorityScheduler(SchedulerOldestFirst, "main", engine, WithRecorder(selected))
+	queues := addQueues(t, ps, engine, map[string]int{"first": 2, "second": 1}, "first", "second")
+	enqueue(t, queues["second"], 1)
+	time.Sleep(5 * time.Millisecond)
+	enqueue(t, queues["first"], 3)
+
+	if _, err := ps.GetTask(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if selected.recorded[0] != "second" {
+		t.Fatalf("selected %s, want second whose head waited longest", selected.recorded[0])
+	}
+}
+
+func TestLotteryFollowsWeights(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	selected := &selection{}
+	ps := NewPriorityScheduler(SchedulerLottery, "main", engine, WithRecorder(selected))
+	queues := addQueues(t, ps, engine, map[string]int{"heavy": 3, "light": 1}, "heavy", "light")
+	const draws = 400
+	enqueue(t, queues["heavy"], draws)
+	enqueue(t, queues["light"], draws)
+
+	for i := 0; i < draws; i++ {
+		if _, err := ps.GetTask(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	heavy := 0
+	for _, name := range selected.recorded {
+		if name == "heavy" {
+			heavy++
+		}
+	}
+	// 期望 300，标准差约 8.7
+	if heavy < 250 || heavy > 350 {
+		t.Fatalf("heavy selected %d of %d draws, want about 3/4", heavy, draws)
+	}
+}
+
+// 三种积压调度模式都跳过暂停和空的队列
+func TestDepthModesSkipPausedAndEmpty(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []SchedulerMode{SchedulerLongestQueueFirst, SchedulerOldestFirst, SchedulerLottery} {
+		t.Run(string(mode), func(t *testing.T) {
+			_, engine := testredis.New(t)
+			selected := &selection{}
+			ps := NewPriorityScheduler(mode, "main", engine, WithRecorder(selected))
+			queues := addQueues(t, ps, engine, map[string]int{"paused": 100, "empty": 100, "open": 1}, "paused", "empty", "open")
+			enqueue(t, queues["paused"], 5)
+			time.Sleep(5 * time.Millisecond)
+			enqueue(t, queues["open"], 2)
+			if err := engine.SAdd(ctx, engine.GetPausedKey(), "paused"); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := ps.GetTask(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(selected.recorded, []string{"open", "open"}) {
+				t.Fatalf("selected %v, want only open", selected.recorded)
+			}
+			if _, err := ps.GetTask(ctx); !errors.Is(err, queue.ErrQueueEmpty) {
+				t.Fatalf("err = %v, want ErrQueueEmpty with only paused tasks left", err)
+			}
+		})
+	}
+}
@@ -1,20 +1,46 @@
 package taskstruct
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"time"
 )
 
 type Task struct {
-	ID       string                 `json:"id"`        // 任务ID
-	Type     string                 `json:"type"`      // 任务类型
-	Payload  map[string]interface{} `json:"payload"`   // 任务负载
-	MaxRetry int                    `json:"max_retry"` // 最大重试次数
-	Created  time.Time              `json:"created"`   // 创建时间
-	Retry    int                    `json:"retry"`     // 重试次数
-	Status   TaskStatus             `json:"status"`    // 任务状态
+	ID       string                 `json:"id"`                 // 任务ID
+	Type     string                 `json:"type"`               // 任务类型
+	Payload  map[string]interface{} `json:"payload"`            // 任务负载
+	MaxRetry int                    `json:"max_retry"`          // 最大重试次数
+	Created  time.Time              `json:"created"`            // 创建时间
+	Retry    int                    `json:"retry"`              // 重试次数
+	Status   TaskStatus             `json:"status"`             // 任务状态
+	Metadata map[string]string      `json:"metadata,omitempty"` // 任务元数据，如链路追踪的 traceparent
+	Queue    string                 `json:"queue,omitempty"`    // 最近一次出队所在的队列名称
+	Errors   []TaskError            `json:"errors,omitempty"`   // 每次执行失败的错误记录
+	Timeout  time.Duration          `json:"timeout,omitempty"`  // 单次处理的超时时间，0表示使用队列或类型的默认值
+	Group    string                 `json:"group,omitempty"`    // 聚合分组，非空时入队后等待与同组任务合并
+	Result   map[string]interface{} `json:"result,omitempty"`   // 处理函数写入的结果，工作流中传给后续任务
+	Priority int                    `json:"priority,omitempty"` // 优先级队列中的优先级，越大越先出队
+	ReadyAt  int64                  `json:"ready_at,omitempty"` // 进入就绪列表(延迟任务为到期)的毫秒时间戳，调度器据此计算等待时间
+	Deadline time.Time              `json:"deadline"`           // 截止时间，非零时在普通队列中按截止时间从早到晚出队
+	Tenant   string                 `json:"tenant,omitempty"`   // 租户，非空时放入租户子队列，各租户之间公平出队
 }
 
+// TaskError 一次执行失败的记录
+type TaskError struct {
+	Kind    string    `json:"kind"`    // 错误种类
+	Message string    `json:"message"` // 错误信息
+	Time    time.Time `json:"time"`    // 失败时间
+}
+
+// 错误种类
+const (
+	TaskErrorHandler = "error"   // 处理函数返回错误
+	TaskErrorPanic   = "panic"   // 处理函数panic
+	TaskErrorTimeout = "timeout" // 处理超时
+)
+
 type TaskStatus string
 
 const (
@@ -26,10 +52,49 @@ const (
 	TaskStatusDeadLetter TaskStatus = "dead"       // 死信
 )
 
+// NewTask 创建一个随机ID的待处理任务
+func NewTask(taskType string, payload map[string]interface{}, maxRetry int) *Task {
+	return &Task{
+		ID:       NewTaskID(),
+		Type:     taskType,
+		Payload:  payload,
+		MaxRetry: maxRetry,
+		Created:  time.Now(),
+		Status:   TaskStatusPending,
+	}
+}
+
+func NewTaskID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("task_%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// 任务体在 RedisEngine 哈希中的字段前缀
+const TaskKeyPrefix = "task:"
+
 func (t *Task) GetTaskKey() string {
-	return fmt.Sprintf("task:%s", t.ID)
+	return TaskKeyPrefix + t.ID
+}
+
+// ReadyTime 任务进入就绪状态的时间，没有 ReadyAt 时(旧版本写入的任务)为创建时间
+func (t *Task) ReadyTime() time.Time {
+	if t.ReadyAt > 0 {
+		return time.UnixMilli(t.ReadyAt)
+	}
+	return t.Created
+}
+
+// AddError 追加一条失败记录
+func (t *Task) AddError(kind string, err error) {
+	t.Errors = append(t.Errors, TaskError{Kind: kind, Message: err.Error(), Time: time.Now()})
 }
 
+// ProgressTask 模拟处理任务，耗时1秒后标记为完成
+//
+// Deprecated: 任务由 worker.Server 按类型分发给处理函数处理，请改用 worker.ServeMux 注册处理函数
 func (t *Task) ProgressTask() {
 	fmt.Printf("任务%s 处理中 \n", t.ID)
 	t.Status = TaskStatusProcessing
@@ -37,6 +102,9 @@ func (t *Task) ProgressTask() {
 	t.Status = TaskStatusCompleted
 }
 
+// ProgressFailedTask 模拟处理失败的任务
+//
+// Deprecated: 处理函数返回错误即视为失败，由 worker.Server 负责重试和死信
 func (t *Task) ProgressFailedTask() {
 	fmt.Printf("任务%s 处理中，假设执行失败 \n", t.ID)
 	t.Status = TaskStatusFailed
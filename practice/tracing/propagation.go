@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	TraceParentKey = "traceparent"
+	TraceStateKey  = "tracestate"
+)
+
+// Inject 把ctx中的span标识写入任务元数据，ctx中没有有效span时不写入
+func Inject(ctx context.Context, metadata map[string]string) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	metadata[TraceParentKey] = fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+	if sc.TraceState != "" {
+		metadata[TraceStateKey] = sc.TraceState
+	} else {
+		delete(metadata, TraceStateKey)
+	}
+}
+
+// Extract 从任务元数据解析上游span标识放入ctx，解析失败时原样返回ctx
+func Extract(ctx context.Context, metadata map[string]string) context.Context {
+	sc, ok := parseTraceParent(metadata[TraceParentKey])
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = metadata[TraceStateKey]
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// traceparent 格式: version-traceid-spanid-flags，例如
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceParent(value string) (SpanContext, bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// 版本 00 必须恰好四段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	return sc, sc.IsValid()
+}
+
+// 只接受小写十六进制，长度必须与目标一致
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// RecordedSpan 内存记录器保存的已结束span
+type RecordedSpan struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Attributes  map[string]interface{}
+	Errors      []error
+	Start       time.Time
+	End         time.Time
+}
+
+// Recorder 把span保存在内存中的 Tracer，用于测试和调试
+type Recorder struct {
+	mutex sync.Mutex
+	spans []*RecordedSpan
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{Flags: 0x01, TraceState: parent.TraceState}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &recordingSpan{
+		recorder: r,
+		data: &RecordedSpan{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Attributes:  make(map[string]interface{}),
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Spans 返回已结束的span，按结束顺序排列
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	spans := make([]*RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	r.spans = nil
+	r.mutex.Unlock()
+}
+
+type recordingSpan struct {
+	recorder *Recorder
+	mutex    sync.Mutex
+	data     *RecordedSpan
+	ended    bool
+}
+
+func (s *recordingSpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended && err != nil {
+		s.data.Errors = append(s.data.Errors, err)
+	}
+}
+
+func (s *recordingSpan) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.mutex.Unlock()
+
+	s.recorder.mutex.Lock()
+	s.recorder.spans = append(s.recorder.spans, s.data)
+	s.recorder.mutex.Unlock()
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"practice/taskstruct"
+)
+
+const (
+	SpanEnqueue = "redistrain.enqueue"
+	SpanDequeue = "redistrain.dequeue"
+	SpanProcess = "redistrain.process"
+)
+
+// StartEnqueueSpan 创建入队span，并把它的标识写入任务元数据
+func StartEnqueueSpan(ctx context.Context, tracer Tracer, queue string, task *taskstruct.Task) (context.Context, Span) {
+	ctx, span := tracer.Start(ctx, SpanEnqueue)
+	setTaskAttributes(span, queue, task)
+	if task.Metadata == nil {
+		task.Metadata = make(map[string]string)
+	}
+	Inject(ctx, task.Metadata)
+	return ctx, span
+}
+
+// StartDequeueSpan 以任务元数据中的入队span为父span创建出队span
+func StartDequeueSpan(ctx context.Context, tracer Tracer, queue string, task *taskstruct.Task) (context.Context, Span) {
+	ctx, span := tracer.Start(Extract(ctx, task.Metadata), SpanDequeue)
+	setTaskAttributes(span, queue, task)
+	return ctx, span
+}
+
+// StartProcessSpan 以任务元数据中的入队span为父span创建处理任务的span
+func StartProcessSpan(ctx context.Context, tracer Tracer, queue string, task *taskstruct.Task) (context.Context, Span) {
+	ctx, span := tracer.Start(Extract(ctx, task.Metadata), SpanProcess)
+	setTaskAttributes(span, queue, task)
+	span.SetAttribute("attempt", task.Retry)
+	return ctx, span
+}
+
+func setTaskAttributes(span Span, queue string, task *taskstruct.Task) {
+	span.SetAttribute("queue", queue)
+	span.SetAttribute("task_id", task.ID)
+	span.SetAttribute("type", task.Type)
+}
@@ -0,0 +1,75 @@
+// 链路追踪
+
+// 在任务元数据中按 W3C Trace Context 传递 traceparent/tracestate，
+// 并通过 Tracer 接口在入队、出队和处理任务时创建 span，默认不做任何记录
+
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext 跨进程传递的span标识
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   // trace-flags，最低位表示采样
+	TraceState string // tracestate 原样透传
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+type Tracer interface {
+	// Start 以 ctx 中的span为父span创建新span，返回的ctx携带新span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 把span标识放入ctx，对接其他追踪系统时用它传入上游span
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// NopTracer 不记录span，只把父span标识原样传下去，保证没有配置追踪时链路也不断
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{sc: SpanContextFromContext(ctx)}
+}
+
+type nopSpan struct {
+	sc SpanContext
+}
+
+func (s nopSpan) SpanContext() SpanContext                   { return s.sc }
+func (s nopSpan) SetAttribute(key string, value interface{}) {}
+func (s nopSpan) RecordError(err error)                      {}
+func (s nopSpan) End()                                       {}
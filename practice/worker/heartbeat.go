@@ -0,0 +1,172 @@
+// worker 注册与心跳
+
+// 服务器启动后在 Redis 中登记自身信息并定期刷新过期时间，
+// 正在处理的任务记录在活跃任务哈希中，worker 消失后可以据此找到丢失的任务
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"practice/queue"
+	"practice/taskstruct"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkerInfo 登记在 Redis 中的 worker 信息
+type WorkerInfo struct {
+	ID          string    `json:"id"`
+	Host        string    `json:"host"`
+	PID         int       `json:"pid"`
+	Queues      []string  `json:"queues"`
+	Concurrency int       `json:"concurrency"`
+	StartedAt   time.Time `json:"started_at"`
+	Version     string    `json:"version"`
+	ActiveTasks []string  `json:"active_tasks"` // 最近一次心跳时正在处理的任务ID
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+// ActiveTask 正在处理的任务，任务体已经从队列中取出，只保存在这里
+type ActiveTask struct {
+	WorkerID  string           `json:"worker_id"`
+	Queue     string           `json:"queue"`
+	Kind      string           `json:"kind,omitempty"` // 任务来源的队列种类，找回任务时放回同种队列
+	Task      *taskstruct.Task `json:"task"`
+	StartedAt time.Time        `json:"started_at"`
+}
+
+// activeSet 本进程正在处理的任务ID
+type activeSet struct {
+	mutex sync.Mutex
+	ids   map[string]struct{}
+}
+
+func (a *activeSet) add(id string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.ids[id] = struct{}{}
+}
+
+func (a *activeSet) remove(id string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.ids, id)
+}
+
+func (a *activeSet) list() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	ids := make([]string, 0, len(a.ids))
+	for id := range a.ids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func newWorkerID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), taskstruct.NewTaskID()[:8])
+}
+
+// sourceQueues 任务来源包含的队列名称
+func sourceQueues(source Source) []string {
+	switch src := source.(type) {
+	case interface{ QueueNames() []string }:
+		return src.QueueNames()
+	case interface{ GetName() string }:
+		return []string{src.GetName()}
+	}
+	return nil
+}
+
+// heartbeatLoop 每隔 heartbeatInterval 刷新一次登记信息，直到 ctx 被取消
+func (s *Server) heartbeatLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.heartbeat(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Error("heartbeat failed", "worker_id", s.id, "error", err)
+			}
+		}
+	}
+}
+
+// heartbeat 写入 worker 信息，过期时间为三个心跳间隔，同时从集合中移除已过期的 worker
+func (s *Server) heartbeat(ctx context.Context) error {
+	now := time.Now()
+	ttl := 3 * s.heartbeatInterval
+	info := &WorkerInfo{
+		ID:          s.id,
+		Host:        s.host,
+		PID:         os.Getpid(),
+		Queues:      sourceQueues(s.source),
+		Concurrency: s.concurrency,
+		StartedAt:   s.startedAt,
+		Version:     s.version,
+		ActiveTasks: s.active.list(),
+		HeartbeatAt: now,
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("序列化 worker 信息失败: %w", err)
+	}
+
+	if err := s.redisEngine.SetWithExpire(ctx, s.redisEngine.GetWorkerKey(s.id), data, ttl); err != nil {
+		return fmt.Errorf("写入 worker 信息失败: %w", err)
+	}
+	if err := s.redisEngine.ZAdd(ctx, s.redisEngine.GetWorkersKey(), float64(now.Add(ttl).UnixMilli()), s.id); err != nil {
+		return fmt.Errorf("登记 worker 失败: %w", err)
+	}
+	// 异常退出的 worker 没有注销，过期后由存活的 worker 清理，它们正在处理的任务留在活跃任务哈希中等待找回
+	if err := s.redisEngine.ZRemRangeByScore(ctx, s.redisEngine.GetWorkersKey(), "-inf", fmt.Sprintf("(%d", now.UnixMilli())); err != nil {
+		return fmt.Errorf("清理过期 worker 失败: %w", err)
+	}
+	return nil
+}
+
+// deregister 正常退出时注销 worker
+func (s *Server) deregister(ctx context.Context) {
+	if err := s.redisEngine.ZRem(ctx, s.redisEngine.GetWorkersKey(), s.id); err != nil {
+		s.logger.Error("deregister worker failed", "worker_id", s.id, "error", err)
+	}
+	if err := s.redisEngine.Del(ctx, s.redisEngine.GetWorkerKey(s.id)); err != nil {
+		s.logger.Error("deregister worker failed", "worker_id", s.id, "error", err)
+	}
+}
+
+// trackTask 开始处理前登记任务，worker 消失时任务体仍可以从活跃任务哈希中找回
+func (s *Server) trackTask(ctx context.Context, task *taskstruct.Task) {
+	s.active.add(task.ID)
+	data, err := json.Marshal(&ActiveTask{WorkerID: s.id, Queue: task.Queue, Kind: s.sourceKind(), Task: task, StartedAt: time.Now()})
+	if err != nil {
+		s.logger.Error("marshal active task failed", "task_id", task.ID, "error", err)
+		return
+	}
+	if err := s.redisEngine.HSet(ctx, s.redisEngine.GetActiveKey(), task.ID, data); err != nil {
+		s.logger.Error("track active task failed", "task_id", task.ID, "error", err)
+	}
+}
+
+// sourceKind 任务来源的队列种类，只有优先级队列的任务需要放回优先级ZSet，其余都放回普通队列
+func (s *Server) sourceKind() string {
+	if _, ok := s.source.(*queue.PriorityQueue); ok {
+		return queue.KindPriority
+	}
+	return queue.KindQueue
+}
+
+func (s *Server) untrackTask(ctx context.Context, task *taskstruct.Task) {
+	s.active.remove(task.ID)
+	if err := s.redisEngine.HDel(ctx, s.redisEngine.GetActiveKey(), task.ID); err != nil {
+		s.logger.Error("untrack active task failed", "task_id", task.ID, "error", err)
+	}
+}
@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"context"
+	"practice/taskstruct"
+)
+
+// Hook 任务最终结果的回调，任务确认成功或进入死信队列后调用，重试中的失败不会触发
+// workflow.Engine 实现了该接口
+type Hook interface {
+	TaskCompleted(ctx context.Context, task *taskstruct.Task) error
+	TaskDead(ctx context.Context, task *taskstruct.Task) error
+}
+
+func (s *Server) taskCompleted(ctx context.Context, task *taskstruct.Task) {
+	for _, hook := range s.hooks {
+		if err := hook.TaskCompleted(ctx, task); err != nil {
+			s.logger.Error("task completed hook failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		}
+	}
+}
+
+func (s *Server) taskDead(ctx context.Context, task *taskstruct.Task) {
+	for _, hook := range s.hooks {
+		if err := hook.TaskDead(ctx, task); err != nil {
+			s.logger.Error("task dead hook failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		}
+	}
+}
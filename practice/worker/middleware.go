@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"practice/logging"
+	"practice/taskstruct"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError 处理函数panic时由 Recover 中间件转换成的错误，错误信息包含调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Recover 把处理函数的panic转换为 *PanicError，任务按失败处理并在错误记录中保留调用栈
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, task *taskstruct.Task) (err error) {
+			defer func() {
+				if value := recover(); value != nil {
+					err = &PanicError{Value: value, Stack: debug.Stack()}
+				}
+			}()
+			return next.ProcessTask(ctx, task)
+		})
+	}
+}
+
+// Logging 记录每个任务的开始、结束和耗时
+func Logging(logger logging.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, task *taskstruct.Task) error {
+			start := time.Now()
+			logger.Debug("task started", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "attempt", task.Retry)
+
+			err := next.ProcessTask(ctx, task)
+			if err != nil {
+				logger.Warn("task finished with error", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "attempt", task.Retry, "duration", time.Since(start), "error", err)
+				return err
+			}
+			logger.Info("task finished", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "attempt", task.Retry, "duration", time.Since(start))
+			return nil
+		})
+	}
+}
+
+// ProcessingObserver 接收处理耗时，metrics.Metrics 实现了该接口
+type ProcessingObserver interface {
+	ObserveProcessing(queue, taskType string, duration time.Duration)
+}
+
+// Metrics 记录每个任务的处理耗时
+func Metrics(observer ProcessingObserver) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, task *taskstruct.Task) error {
+			start := time.Now()
+			err := next.ProcessTask(ctx, task)
+			observer.ObserveProcessing(task.Queue, task.Type, time.Since(start))
+			return err
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"practice/taskstruct"
+	"sync"
+)
+
+var (
+	// ErrHandlerNotFound 没有为任务类型注册处理函数
+	ErrHandlerNotFound = errors.New("处理函数不存在")
+	// ErrSkipRetry 处理函数返回包装了它的错误时，任务直接进入死信队列
+	ErrSkipRetry = errors.New("跳过重试")
+)
+
+type Handler interface {
+	ProcessTask(ctx context.Context, task *taskstruct.Task) error
+}
+
+type HandlerFunc func(ctx context.Context, task *taskstruct.Task) error
+
+func (f HandlerFunc) ProcessTask(ctx context.Context, task *taskstruct.Task) error {
+	return f(ctx, task)
+}
+
+// Middleware 包装处理函数，用于日志、恢复panic、指标等通用逻辑，超时由 WithTimeout 系列选项控制
+type Middleware func(Handler) Handler
+
+// ServeMux 按 Task.Type 把任务分发给注册的处理函数
+type ServeMux struct {
+	mutex       sync.RWMutex
+	handlers    map[string]Handler
+	middlewares []Middleware
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{handlers: make(map[string]Handler)}
+}
+
+// Use 追加中间件，先追加的在外层，对所有任务类型生效
+func (mux *ServeMux) Use(middlewares ...Middleware) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.middlewares = append(mux.middlewares, middlewares...)
+}
+
+func (mux *ServeMux) Handle(taskType string, handler Handler) {
+	mux.mutex.Lock()
+	defer mux.mutex.Unlock()
+	mux.handlers[taskType] = handler
+}
+
+func (mux *ServeMux) HandleFunc(taskType string, handler func(ctx context.Context, task *taskstruct.Task) error) {
+	mux.Handle(taskType, HandlerFunc(handler))
+}
+
+// Handler 返回任务类型对应的处理函数
+func (mux *ServeMux) Handler(taskType string) (Handler, bool) {
+	mux.mutex.RLock()
+	defer mux.mutex.RUnlock()
+	handler, ok := mux.handlers[taskType]
+	return handler, ok
+}
+
+func (mux *ServeMux) ProcessTask(ctx context.Context, task *taskstruct.Task) error {
+	mux.mutex.RLock()
+	var handler Handler = HandlerFunc(mux.dispatch)
+	for i := len(mux.middlewares) - 1; i >= 0; i-- {
+		handler = mux.middlewares[i](handler)
+	}
+	mux.mutex.RUnlock()
+
+	return handler.ProcessTask(ctx, task)
+}
+
+func (mux *ServeMux) dispatch(ctx context.Context, task *taskstruct.Task) error {
+	handler, ok := mux.Handler(task.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrHandlerNotFound, task.Type)
+	}
+	return handler.ProcessTask(ctx, task)
+}
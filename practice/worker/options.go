@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"practice/logging"
+	"practice/queue"
+	"practice/ratelimit"
+	"practice/tracing"
+	"time"
+)
+
+// Option 服务器的可选配置，在构造函数中传入
+type Option func(*Server)
+
+// WithConcurrency 同时处理任务的协程数，默认为1
+func WithConcurrency(concurrency int) Option {
+	return func(s *Server) {
+		if concurrency > 0 {
+			s.concurrency = concurrency
+		}
+	}
+}
+
+// WithPollInterval 任务来源为空时等待多久再拉取，默认1秒
+func WithPollInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = interval
+	}
+}
+
+// WithShutdownTimeout 退出时等待正在处理的任务结束的最长时间，默认8秒
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = timeout
+	}
+}
+
+// 重试退避的最小基数，过小的退避会让失败任务立刻重新出队
+const minRetryBaseDelay = 10 * time.Millisecond
+
+// WithRetry 失败任务的重试退避和默认最大重试次数，任务自身设置了 MaxRetry 时以任务为准
+// baseDelay 小于10毫秒时按10毫秒处理，maxDelay 小于 baseDelay 时取 baseDelay，maxRetry 为负数时忽略
+func WithRetry(baseDelay, maxDelay time.Duration, maxRetry int) Option {
+	return func(s *Server) {
+		if baseDelay < minRetryBaseDelay {
+			baseDelay = minRetryBaseDelay
+		}
+		if maxDelay < baseDelay {
+			maxDelay = baseDelay
+		}
+		s.retryBaseDelay = baseDelay
+		s.retryMaxDelay = maxDelay
+		if maxRetry >= 0 {
+			s.maxRetry = maxRetry
+		}
+	}
+}
+
+// WithQueueOptions 确认、重试、死信时创建队列使用的配置
+func WithQueueOptions(opts ...queue.Option) Option {
+	return func(s *Server) {
+		s.queueOptions = append(s.queueOptions, opts...)
+	}
+}
+
+// WithHeartbeatInterval 刷新 worker 登记信息的间隔，默认5秒，登记信息在三个间隔后过期
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		if interval > 0 {
+			s.heartbeatInterval = interval
+		}
+	}
+}
+
+// WithVersion 登记在 worker 信息中的版本号
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+// WithRateLimiter 处理前检查限流，超过配额的任务推迟到延迟队列，不算作失败
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// WithTypeConcurrency 某种类型的任务在所有 worker 中最多同时处理 limit 个，
+// 没有空余名额时任务留在就绪列表中等待
+func WithTypeConcurrency(taskType string, limit int) Option {
+	return func(s *Server) {
+		s.typeConcurrency[taskType] = limit
+	}
+}
+
+// WithLeaseTTL 并发名额租约的有效期，默认30秒，处理期间每三分之一有效期续约一次
+// worker 异常退出后最多经过一个有效期名额被回收
+func WithLeaseTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.leaseTTL = ttl
+		}
+	}
+}
+
+// WithHook 任务确认成功或进入死信队列后调用 hook，可以多次传入
+func WithHook(hook Hook) Option {
+	return func(s *Server) {
+		s.hooks = append(s.hooks, hook)
+	}
+}
+
+func WithLogger(logger logging.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithTracer 在处理任务时创建span
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(s *Server) {
+		s.tracer = tracer
+	}
+}
+
+// WithTimeout 任务处理的默认超时时间，0表示不限制
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.timeout = timeout
+	}
+}
+
+// WithQueueTimeout 某个队列中任务的默认超时时间，优先于 WithTimeout
+func WithQueueTimeout(queueName string, timeout time.Duration) Option {
+	return func(s *Server) {
+		s.queueTimeouts[queueName] = timeout
+	}
+}
+
+// WithTypeTimeout 某种类型任务的默认超时时间，优先于队列默认值，任务自身的 Timeout 优先级最高
+func WithTypeTimeout(taskType string, timeout time.Duration) Option {
+	return func(s *Server) {
+		s.typeTimeouts[taskType] = timeout
+	}
+}
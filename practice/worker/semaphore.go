@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"practice/queue"
+	"practice/taskstruct"
+	"time"
+)
+
+// semaphoreName 任务类型对应的集群级并发信号量
+func semaphoreName(taskType string) string {
+	return "type:" + taskType
+}
+
+// acquireSlot 任务类型设置了集群级并发上限时申请一个名额，返回的 release 在处理结束后调用
+// 没有空余名额时返回 false
+func (s *Server) acquireSlot(ctx context.Context, task *taskstruct.Task) (release func(), ok bool) {
+	limit, limited := s.typeConcurrency[task.Type]
+	if !limited {
+		return func() {}, true
+	}
+
+	name := semaphoreName(task.Type)
+	acquired, err := s.redisEngine.AcquireSemaphore(ctx, name, task.ID, limit, s.leaseTTL)
+	if err != nil {
+		s.logger.Error("acquire concurrency slot failed", "task_id", task.ID, "type", task.Type, "error", err)
+		return nil, false
+	}
+	if !acquired {
+		return nil, false
+	}
+
+	// 处理期间定期续约，进程退出后租约过期，名额自动回收
+	renewCtx, stopRenew := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(s.leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				extended, err := s.redisEngine.ExtendSemaphore(renewCtx, name, task.ID, s.leaseTTL)
+				if err != nil && renewCtx.Err() == nil {
+					s.logger.Error("extend concurrency slot failed", "task_id", task.ID, "type", task.Type, "error", err)
+				} else if err == nil && !extended {
+					s.logger.Warn("concurrency slot lease expired", "task_id", task.ID, "type", task.Type)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		stopRenew()
+		<-done
+		if err := s.redisEngine.ReleaseSemaphore(ctx, name, task.ID); err != nil {
+			s.logger.Error("release concurrency slot failed", "task_id", task.ID, "type", task.Type, "error", err)
+		}
+	}, true
+}
+
+// holdTask 没有空余名额时把任务放回就绪状态，排在已有任务之后，不计入重试次数
+// 任务来源为优先级队列时放回优先级队列，不消费普通队列的来源放回同名延迟队列，立即到期
+func (s *Server) holdTask(ctx context.Context, task *taskstruct.Task) {
+	var err error
+	switch {
+	case s.sourceKind() == queue.KindPriority:
+		err = queue.NewPriorityQueue(task.Queue, s.redisEngine, s.queueOptions...).ReturnTask(ctx, task)
+	case s.forwardsScheduled():
+		err = queue.NewQueue(task.Queue, s.redisEngine, s.queueOptions...).ReturnTask(ctx, task)
+	default:
+		err = queue.NewDelayQueue(task.Queue, s.redisEngine, 0, s.queueOptions...).ScheduleTask(ctx, task, time.Now())
+	}
+	if err != nil {
+		s.logger.Error("hold task failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		return
+	}
+	s.logger.Debug("task held for concurrency slot", "queue", task.Queue, "task_id", task.ID, "type", task.Type)
+}
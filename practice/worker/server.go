@@ -0,0 +1,362 @@
+// 任务处理服务器
+
+// 从队列或调度器拉取任务，按 Task.Type 分发给处理函数，
+// 成功时确认任务，失败时交给重试队列，超过重试次数进入死信队列
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"practice/logging"
+	"practice/queue"
+	"practice/ratelimit"
+	"practice/redisengine"
+	"practice/scheduler"
+	"practice/taskstruct"
+	"practice/tracing"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Source 任务来源，queue.Queue、queue.DelayQueue、queue.RetryQueue 和 scheduler.PriorityScheduler 都实现了该接口
+// 没有任务时应返回 queue.ErrQueueEmpty
+type Source interface {
+	DequeueTask(ctx context.Context) (*taskstruct.Task, error)
+}
+
+// Requeuer 可以归还未处理完任务的任务来源，其他来源的任务归还到同名的普通队列
+type Requeuer interface {
+	RequeueTask(ctx context.Context, task *taskstruct.Task) error
+}
+
+var (
+	_ Requeuer = (*queue.Queue)(nil)
+	_ Requeuer = (*queue.DelayQueue)(nil)
+	_ Requeuer = (*queue.PriorityQueue)(nil)
+)
+
+var (
+	_ Source = (*queue.Queue)(nil)
+	_ Source = (*queue.DelayQueue)(nil)
+	_ Source = (*queue.PriorityQueue)(nil)
+	_ Source = (*scheduler.PriorityScheduler)(nil)
+)
+
+type Server struct {
+	redisEngine *redisengine.RedisEngine
+	source      Source
+	handler     Handler
+
+	concurrency     int
+	pollInterval    time.Duration
+	shutdownTimeout time.Duration
+	retryBaseDelay  time.Duration
+	retryMaxDelay   time.Duration
+	maxRetry        int
+	queueOptions    []queue.Option
+	timeout         time.Duration
+	queueTimeouts   map[string]time.Duration
+	typeTimeouts    map[string]time.Duration
+	logger          logging.Logger
+	tracer          tracing.Tracer
+
+	id                string
+	host              string
+	version           string
+	heartbeatInterval time.Duration
+	startedAt         time.Time
+	active            *activeSet
+
+	limiter         *ratelimit.Limiter
+	typeConcurrency map[string]int
+	leaseTTL        time.Duration
+	hooks           []Hook
+}
+
+func NewServer(redisEngine *redisengine.RedisEngine, source Source, handler Handler, opts ...Option) *Server {
+	s := &Server{
+		redisEngine:       redisEngine,
+		source:            source,
+		handler:           handler,
+		concurrency:       1,
+		pollInterval:      time.Second,
+		shutdownTimeout:   8 * time.Second,
+		retryBaseDelay:    time.Second,
+		retryMaxDelay:     time.Hour,
+		maxRetry:          3,
+		queueTimeouts:     make(map[string]time.Duration),
+		typeTimeouts:      make(map[string]time.Duration),
+		logger:            logging.Nop{},
+		tracer:            tracing.NopTracer{},
+		id:                newWorkerID(),
+		version:           "dev",
+		heartbeatInterval: 5 * time.Second,
+		active:            &activeSet{ids: make(map[string]struct{})},
+		typeConcurrency:   make(map[string]int),
+		leaseTTL:          30 * time.Second,
+	}
+	s.host, _ = os.Hostname()
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ID 登记在 Redis 中的 worker ID
+func (s *Server) ID() string {
+	return s.id
+}
+
+// Run 启动 concurrency 个协程拉取并处理任务，直到 ctx 被取消
+// ctx 取消后停止拉取，最多等待 shutdownTimeout 让正在处理的任务结束，
+// 超时后取消处理函数的 ctx，并把没有处理完的任务放回原队列
+func (s *Server) Run(ctx context.Context) error {
+	s.startedAt = time.Now()
+
+	// 心跳持续到所有任务处理结束，不随 ctx 取消
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopHeartbeat()
+	if err := s.heartbeat(heartbeatCtx); err != nil {
+		return err
+	}
+	heartbeatDone := make(chan struct{})
+	go func() {
+		s.heartbeatLoop(heartbeatCtx)
+		close(heartbeatDone)
+	}()
+
+	s.logger.Info("worker server started", "worker_id", s.id, "concurrency", s.concurrency)
+
+	// 处理函数的 ctx 不随拉取的 ctx 取消，由 abort 在等待超时后取消
+	handlerCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
+
+	var wg sync.WaitGroup
+	if s.forwardsScheduled() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.forwardLoop(ctx)
+		}()
+	}
+	for i := 0; i < s.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, handlerCtx)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+	s.logger.Info("worker server shutting down", "timeout", s.shutdownTimeout)
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		s.logger.Warn("shutdown timeout exceeded, aborting in-flight tasks")
+		abort()
+		<-done
+	}
+
+	stopHeartbeat()
+	<-heartbeatDone
+	s.deregister(context.WithoutCancel(ctx))
+
+	s.logger.Info("worker server stopped", "worker_id", s.id)
+	return nil
+}
+
+// RunUntilSignal 同 Run，收到 SIGTERM 或 SIGINT 时开始优雅退出
+func (s *Server) RunUntilSignal(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	return s.Run(ctx)
+}
+
+// loop 用 ctx 控制是否继续拉取，任务在 handlerCtx 下处理
+func (s *Server) loop(ctx, handlerCtx context.Context) {
+	for ctx.Err() == nil {
+		// 拉取本身不随 ctx 取消，避免任务已经出队但结果没有返回
+		task, err := s.source.DequeueTask(handlerCtx)
+		if err != nil {
+			if !errors.Is(err, queue.ErrQueueEmpty) && ctx.Err() == nil {
+				s.logger.Error("dequeue failed", "error", err)
+			}
+			if !sleep(ctx, s.pollInterval) {
+				return
+			}
+			continue
+		}
+		// 任务因为没有并发名额被放回时稍等再拉取，避免反复取到同一批任务
+		if held := s.process(handlerCtx, task); held && !sleep(ctx, s.pollInterval) {
+			return
+		}
+	}
+}
+
+// process 处理一个任务，返回 true 表示任务因为没有并发名额被放回了队列
+func (s *Server) process(ctx context.Context, task *taskstruct.Task) (held bool) {
+	ctx, span := tracing.StartProcessSpan(ctx, s.tracer, task.Queue, task)
+	defer span.End()
+
+	// 上报结果不受 ctx 取消影响，避免任务已执行但结果丢失
+	reportCtx := context.WithoutCancel(ctx)
+
+	release, ok := s.acquireSlot(reportCtx, task)
+	if !ok {
+		s.holdTask(reportCtx, task)
+		return true
+	}
+	defer release()
+
+	if s.throttle(reportCtx, task) {
+		return false
+	}
+
+	task.Status = taskstruct.TaskStatusProcessing
+	s.trackTask(reportCtx, task)
+	defer s.untrackTask(reportCtx, task)
+
+	err := s.runHandler(ctx, task)
+	if err != nil && ctx.Err() == context.Canceled {
+		s.requeue(reportCtx, task)
+		return false
+	}
+	if err != nil {
+		span.RecordError(err)
+		s.fail(reportCtx, task, errorKind(err), err)
+		return false
+	}
+	s.ack(reportCtx, task)
+	return false
+}
+
+// runHandler 在超时限制下执行处理函数
+// 超时或 ctx 被取消只是通知处理函数退出，仍然等待它返回，处理函数在返回前一直占用并发名额
+// 处理函数在超时后仍然成功返回时按成功处理，避免已经完成的任务被再次执行
+func (s *Server) runHandler(ctx context.Context, task *taskstruct.Task) error {
+	timeout := s.timeoutFor(task)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := s.handler.ProcessTask(ctx, task)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == nil {
+		return err
+	}
+	// 保证错误链中包含 ctx 的错误，errorKind 据此判断是否超时
+	if !errors.Is(err, ctx.Err()) {
+		err = fmt.Errorf("%w: %w", err, ctx.Err())
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("任务 %s 处理超时 %s: %w", task.ID, timeout, err)
+	}
+	return fmt.Errorf("任务 %s 处理被中断: %w", task.ID, err)
+}
+
+// timeoutFor 超时时间的优先级: 任务自身 > 任务类型 > 队列 > 服务器默认
+func (s *Server) timeoutFor(task *taskstruct.Task) time.Duration {
+	if task.Timeout > 0 {
+		return task.Timeout
+	}
+	if timeout, ok := s.typeTimeouts[task.Type]; ok {
+		return timeout
+	}
+	if timeout, ok := s.queueTimeouts[task.Queue]; ok {
+		return timeout
+	}
+	return s.timeout
+}
+
+func (s *Server) ack(ctx context.Context, task *taskstruct.Task) {
+	if err := queue.NewQueue(task.Queue, s.redisEngine, s.queueOptions...).AckTask(ctx, task); err != nil {
+		s.logger.Error("ack task failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		return
+	}
+	s.logger.Debug("task processed", "queue", task.Queue, "task_id", task.ID, "type", task.Type)
+	s.taskCompleted(ctx, task)
+}
+
+// requeue 退出时把没有处理完的任务放回原队列，不计入重试次数
+func (s *Server) requeue(ctx context.Context, task *taskstruct.Task) {
+	requeuer, ok := s.source.(Requeuer)
+	if !ok {
+		requeuer = queue.NewQueue(task.Queue, s.redisEngine, s.queueOptions...)
+	}
+	if err := requeuer.RequeueTask(ctx, task); err != nil {
+		s.logger.Error("requeue task failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		return
+	}
+	s.logger.Warn("unfinished task requeued", "queue", task.Queue, "task_id", task.ID, "type", task.Type)
+}
+
+// fail 记录失败原因后交给重试队列，处理函数要求跳过重试时直接进入死信队列
+func (s *Server) fail(ctx context.Context, task *taskstruct.Task, kind string, err error) {
+	task.AddError(kind, err)
+	s.logger.Warn("task failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "attempt", task.Retry, "kind", kind, "error", err)
+
+	retryQueue := s.retryQueue(task)
+	var reportErr error
+	if errors.Is(err, ErrSkipRetry) {
+		reportErr = retryQueue.DeadLetterTask(ctx, task)
+	} else {
+		reportErr = retryQueue.EnqueueTask(ctx, task)
+	}
+	if reportErr != nil {
+		s.logger.Error("report task failure failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", reportErr)
+		return
+	}
+	if task.Status == taskstruct.TaskStatusDeadLetter {
+		s.taskDead(ctx, task)
+	}
+}
+
+func (s *Server) retryQueue(task *taskstruct.Task) *queue.RetryQueue {
+	maxRetry := s.maxRetry
+	if task.MaxRetry > 0 {
+		maxRetry = task.MaxRetry
+	}
+	return queue.NewRetryQueue(task.Queue, s.redisEngine, s.retryBaseDelay, s.retryMaxDelay, maxRetry, s.queueOptions...)
+}
+
+// errorKind 根据错误判断失败种类
+func errorKind(err error) string {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return taskstruct.TaskErrorPanic
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return taskstruct.TaskErrorTimeout
+	}
+	return taskstruct.TaskErrorHandler
+}
+
+// sleep 等待一段时间，ctx 被取消时提前返回 false
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
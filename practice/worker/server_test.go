@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// 处理函数忽略 ctx 超时继续运行时仍然占用并发名额，且按成功处理
+func TestTimeoutKeepsConcurrencyBound(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, engine := testredis.New(t)
+	source := queue.NewQueue("emails", engine)
+	for i := 0; i < 3; i++ {
+		if err := source.EnqueueTask(ctx, taskstruct.NewTask("send", nil, 3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var running, maxRunning, calls int32
+	var wg sync.WaitGroup
+	wg.Add(3)
+	handler := HandlerFunc(func(ctx context.Context, task *taskstruct.Task) error {
+		defer wg.Done()
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	server := NewServer(engine, source, handler, WithTimeout(5*time.Millisecond), WithPollInterval(10*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(ctx) }()
+	wg.Wait()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if maxRunning != 1 {
+		t.Fatalf("max concurrent handlers = %d, want 1", maxRunning)
+	}
+	if calls != 3 {
+		t.Fatalf("handler calls = %d, want 3", calls)
+	}
+	retries, err := engine.ZCard(context.Background(), queue.QueueKey(queue.KindRetry, "emails"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retries != 0 {
+		t.Fatalf("retry queue size = %d, want 0 for handlers that finished", retries)
+	}
+}
+
+// 超时后返回错误的任务进入重试队列，错误种类为超时
+func TestTimeoutErrorIsRetried(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, engine := testredis.New(t)
+	source := queue.NewQueue("emails", engine)
+	task := taskstruct.NewTask("send", nil, 3)
+	if err := source.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan struct{})
+	handler := HandlerFunc(func(ctx context.Context, task *taskstruct.Task) error {
+		defer close(handled)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	server := NewServer(engine, source, handler, WithTimeout(10*time.Millisecond), WithPollInterval(10*time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() { done <- server.Run(ctx) }()
+	<-handled
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := engine.ZRangeWithScores(context.Background(), queue.QueueKey(queue.KindRetry, "emails"), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("retry queue = %v, want the timed out task", infos)
+	}
+	taskData, err := engine.HGet(context.Background(), engine.GetName(), task.GetTaskKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &taskstruct.Task{}
+	if err := json.Unmarshal([]byte(taskData), stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Errors) != 1 || stored.Errors[0].Kind != taskstruct.TaskErrorTimeout {
+		t.Fatalf("errors = %+v, want one timeout error", stored.Errors)
+	}
+}
+
+func TestHeartbeatPrunesExpiredWorkers(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	if err := engine.ZAdd(ctx, engine.GetWorkersKey(), float64(time.Now().Add(-time.Minute).UnixMilli()), "dead"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(engine, queue.NewQueue("emails", engine), HandlerFunc(func(context.Context, *taskstruct.Task) error { return nil }))
+	if err := server.heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := engine.ZRangeWithScores(ctx, engine.GetWorkersKey(), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].Member != server.ID() {
+		t.Fatalf("workers = %v, want only %s", members, server.ID())
+	}
+}
+
+// 优先级队列中失败重试的任务到期后回到优先级队列
+func TestPriorityRetryReturnsToPriorityQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, engine := testredis.New(t)
+	source := queue.NewPriorityQueue("emails", engine)
+	task := taskstruct.NewTask("send", nil, 3)
+	task.Priority = 5
+	if err := source.EnqueueTask(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	done := make(chan struct{})
+	handler := HandlerFunc(func(ctx context.Context, task *taskstruct.Task) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return errors.New("temporary failure")
+		}
+		close(done)
+		return nil
+	})
+	server := NewServer(engine, source, handler, WithRetry(10*time.Millisecond, 20*time.Millisecond, 3), WithPollInterval(10*time.Millisecond))
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Run(ctx) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retried task was not processed again")
+	}
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"practice/queue"
+	"practice/scheduler"
+	"practice/taskstruct"
+	"time"
+)
+
+// forwardBatch 每次转移到期任务的最大个数
+const forwardBatch = 100
+
+// throttle 检查限流，被限流的任务放回同名延迟队列，到期后再执行，不计入重试次数
+// 返回 true 表示任务已被推迟，不应继续处理
+func (s *Server) throttle(ctx context.Context, task *taskstruct.Task) bool {
+	if s.limiter == nil {
+		return false
+	}
+
+	wait, err := s.limiter.Reserve(ctx, task)
+	if err != nil {
+		// 无法判断是否超过配额时不执行任务，稍后再试
+		s.logger.Error("rate limit check failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		wait = s.pollInterval
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	delayQueue := queue.NewDelayQueue(task.Queue, s.redisEngine, 0, s.queueOptions...)
+	if err := delayQueue.ScheduleTask(ctx, task, time.Now().Add(wait)); err != nil {
+		s.logger.Error("defer rate limited task failed", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "error", err)
+		return false
+	}
+	s.logger.Debug("task rate limited", "queue", task.Queue, "task_id", task.ID, "type", task.Type, "wait", wait)
+	return true
+}
+
+// forwardsScheduled 任务来源为普通队列、优先级队列或调度器时，需要把到期的延迟和重试任务转移到来源消费的队列
+// 被限流推迟和失败重试的任务都在延迟和重试队列中，不转移就不会再被取出
+func (s *Server) forwardsScheduled() bool {
+	switch s.source.(type) {
+	case *queue.Queue, *queue.PriorityQueue, *scheduler.PriorityScheduler:
+		return true
+	}
+	return false
+}
+
+// forwardScheduled 优先级队列的任务按优先级放回优先级队列，其他来源转移到普通队列
+func (s *Server) forwardScheduled(ctx context.Context, name string) (int, error) {
+	if s.sourceKind() == queue.KindPriority {
+		return queue.ForwardScheduledPriority(ctx, s.redisEngine, name, time.Now(), forwardBatch)
+	}
+	return queue.ForwardScheduled(ctx, s.redisEngine, name, time.Now(), forwardBatch)
+}
+
+// forwardLoop 每隔 pollInterval 转移一次到期任务，直到 ctx 被取消
+func (s *Server) forwardLoop(ctx context.Context) {
+	for {
+		for _, name := range sourceQueues(s.source) {
+			moved, err := s.forwardScheduled(ctx, name)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("forward scheduled tasks failed", "queue", name, "error", err)
+				}
+				continue
+			}
+			if moved > 0 {
+				s.logger.Debug("scheduled tasks forwarded", "queue", name, "count", moved)
+			}
+		}
+		if !sleep(ctx, s.pollInterval) {
+			return
+		}
+	}
+}
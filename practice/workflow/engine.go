@@ -0,0 +1,421 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"practice/logging"
+	"practice/queue"
+	"practice/redisengine"
+	"practice/taskstruct"
+	"practice/worker"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+)
+
+// 节点状态
+const (
+	NodePending   = "pending"   // 等待父节点完成
+	NodeEnqueued  = "enqueued"  // 已入队
+	NodeCompleted = "completed" // 已成功
+	NodeFailed    = "failed"    // 进入死信队列
+)
+
+// Status 工作流及各节点的状态
+type Status struct {
+	ID      string                            `json:"id"`
+	State   State                             `json:"state"`
+	Created time.Time                         `json:"created"`
+	Error   string                            `json:"error,omitempty"`
+	Nodes   map[string]string                 `json:"nodes"`   // 节点名->节点状态
+	Results map[string]map[string]interface{} `json:"results"` // 已完成节点的结果
+}
+
+// Key 工作流的Hash，保存图、整体状态、各节点状态、剩余父节点数和结果
+func Key(namespace, id string) string {
+	return fmt.Sprintf("%s:workflow:%s", namespace, id)
+}
+
+// completeScript 节点成功，返回所有父节点都已完成但还没有入队的子节点
+// 节点已经记录为成功时不再重复扣减计数，只返回仍未入队的子节点，子节点入队失败后可以重试
+// ARGV 依次为 节点名、结果、结束后的保留时间(毫秒)、子节点名...
+var completeScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "state") ~= "running" then
+    return {}
+end
+local statusField = "status:" .. ARGV[1]
+if redis.call("HGET", KEYS[1], statusField) ~= "completed" then
+    redis.call("HSET", KEYS[1], statusField, "completed", "result:" .. ARGV[1], ARGV[2])
+    for i = 4, #ARGV do
+        redis.call("HINCRBY", KEYS[1], "pending:" .. ARGV[i], -1)
+    end
+    if redis.call("HINCRBY", KEYS[1], "remaining", -1) == 0 then
+        redis.call("HSET", KEYS[1], "state", "completed")
+        redis.call("PEXPIRE", KEYS[1], ARGV[3])
+        return {}
+    end
+end
+
+local ready = {}
+for i = 4, #ARGV do
+    if tonumber(redis.call("HGET", KEYS[1], "pending:" .. ARGV[i])) == 0
+        and redis.call("HGET", KEYS[1], "status:" .. ARGV[i]) == "pending" then
+        table.insert(ready, ARGV[i])
+    end
+end
+
+return ready
+`)
+
+// markEnqueuedScript 节点仍为等待状态时标记为已入队，任务已经很快完成时不覆盖
+var markEnqueuedScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == "pending" then
+    redis.call("HSET", KEYS[1], ARGV[1], "enqueued")
+end
+return 1
+`)
+
+// failScript 节点失败，工作流仍在运行时标记为失败并返回1
+var failScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "state") ~= "running" then
+    return 0
+end
+
+redis.call("HSET", KEYS[1], "state", "failed", "status:" .. ARGV[1], "failed", "error", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+
+return 1
+`)
+
+var _ worker.Hook = (*Engine)(nil)
+
+// Engine 提交工作流，并作为 worker.Hook 在任务完成时推进工作流
+type Engine struct {
+	redisEngine  *redisengine.RedisEngine
+	queueOptions []queue.Option
+	retention    time.Duration
+	logger       logging.Logger
+}
+
+// Option 工作流引擎的可选配置，在构造函数中传入
+type Option func(*Engine)
+
+// WithQueueOptions 入队时创建队列使用的配置
+func WithQueueOptions(opts ...queue.Option) Option {
+	return func(e *Engine) {
+		e.queueOptions = append(e.queueOptions, opts...)
+	}
+}
+
+// WithRetention 工作流结束后状态的保留时间，默认7天
+func WithRetention(retention time.Duration) Option {
+	return func(e *Engine) {
+		e.retention = retention
+	}
+}
+
+func WithLogger(logger logging.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+func NewEngine(redisEngine *redisengine.RedisEngine, opts ...Option) *Engine {
+	e := &Engine{
+		redisEngine: redisEngine,
+		retention:   7 * 24 * time.Hour,
+		logger:      logging.Nop{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *Engine) key(id string) string {
+	return Key(e.redisEngine.GetName(), id)
+}
+
+// Submit 保存工作流并把根节点入队，返回工作流ID
+// 添加节点时出现过错误的工作流不会提交，返回该错误
+// 每次提交都按模板生成新的任务，同一个 Workflow 可以多次提交，模板本身不会被修改
+func (e *Engine) Submit(ctx context.Context, w *Workflow) (string, error) {
+	if w.err != nil {
+		return "", fmt.Errorf("工作流无效: %w", w.err)
+	}
+	if len(w.nodes) == 0 {
+		return "", fmt.Errorf("工作流没有节点")
+	}
+
+	id := taskstruct.NewTaskID()
+	nodes := make([]*Node, len(w.nodes))
+	for i, template := range w.nodes {
+		nodes[i] = instantiate(id, template)
+	}
+	graph, err := json.Marshal(nodes)
+	if err != nil {
+		return "", fmt.Errorf("序列化工作流失败: %w", err)
+	}
+
+	fields := []interface{}{
+		"graph", graph,
+		"state", string(StateRunning),
+		"created", time.Now().UnixMilli(),
+		"remaining", len(nodes),
+	}
+	for _, node := range nodes {
+		fields = append(fields, "pending:"+node.Name, len(node.Parents), "status:"+node.Name, NodePending)
+	}
+	if err := e.redisEngine.HSet(ctx, e.key(id), fields...); err != nil {
+		return "", fmt.Errorf("保存工作流失败: %w", err)
+	}
+
+	for _, node := range nodes {
+		if len(node.Parents) > 0 {
+			continue
+		}
+		if err := e.enqueue(ctx, id, node, nil); err != nil {
+			return id, err
+		}
+	}
+	e.logger.Info("workflow submitted", "workflow_id", id, "nodes", len(nodes))
+	return id, nil
+}
+
+// instantiate 按模板为一次运行生成节点，任务使用新的ID并在元数据中记录所属工作流和节点
+func instantiate(id string, template *Node) *Node {
+	task := *template.Task
+	task.ID = taskstruct.NewTaskID()
+	task.Created = time.Now()
+	task.Metadata = make(map[string]string, len(template.Task.Metadata)+2)
+	for key, value := range template.Task.Metadata {
+		task.Metadata[key] = value
+	}
+	task.Metadata[MetadataWorkflowID] = id
+	task.Metadata[MetadataNode] = template.Name
+
+	node := *template
+	node.Task = &task
+	return &node
+}
+
+// enqueue 按节点的任务创建副本并入队，parentResults 放入负载
+// 节点任务的ID在提交时已经确定，重复入队返回 ErrDuplicateTask 时说明任务已在队列中，按成功处理
+func (e *Engine) enqueue(ctx context.Context, id string, node *Node, parentResults map[string]interface{}) error {
+	task := *node.Task
+	if len(parentResults) > 0 {
+		payload := make(map[string]interface{}, len(task.Payload)+1)
+		for field, value := range task.Payload {
+			payload[field] = value
+		}
+		payload[ParentResultsKey] = parentResults
+		task.Payload = payload
+	}
+
+	err := queue.NewQueue(node.Queue, e.redisEngine, e.queueOptions...).EnqueueTask(ctx, &task)
+	if err != nil && !errors.Is(err, queue.ErrDuplicateTask) {
+		return fmt.Errorf("工作流 %s 节点 %s 入队失败: %w", id, node.Name, err)
+	}
+	if _, err := e.redisEngine.RunScript(ctx, markEnqueuedScript, []string{e.key(id)}, "status:"+node.Name); err != nil {
+		return fmt.Errorf("更新工作流 %s 节点状态失败: %w", id, err)
+	}
+	return nil
+}
+
+// loadGraph 读取工作流的节点，工作流不存在时返回空
+func (e *Engine) loadGraph(ctx context.Context, id string) (map[string]*Node, error) {
+	data, err := e.redisEngine.HGet(ctx, e.key(id), "graph")
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取工作流失败: %w", err)
+	}
+	nodes := []*Node{}
+	if err := json.Unmarshal([]byte(data), &nodes); err != nil {
+		return nil, fmt.Errorf("反序列化工作流失败: %w", err)
+	}
+	index := make(map[string]*Node, len(nodes))
+	for _, node := range nodes {
+		index[node.Name] = node
+	}
+	return index, nil
+}
+
+// TaskCompleted 记录节点结果，并把所有父节点都已完成的子节点入队
+// 子节点入队失败时返回错误，同一个任务再次调用或调用 Resume 时会重新入队尚未入队的子节点
+func (e *Engine) TaskCompleted(ctx context.Context, task *taskstruct.Task) error {
+	id, name := task.Metadata[MetadataWorkflowID], task.Metadata[MetadataNode]
+	if id == "" {
+		return nil
+	}
+	graph, err := e.loadGraph(ctx, id)
+	if err != nil || graph == nil {
+		return err
+	}
+	node, ok := graph[name]
+	if !ok {
+		return fmt.Errorf("工作流 %s 中没有节点 %s", id, name)
+	}
+
+	result, err := json.Marshal(task.Result)
+	if err != nil {
+		return fmt.Errorf("序列化任务结果失败: %w", err)
+	}
+	args := []interface{}{name, result, e.retention.Milliseconds()}
+	for _, child := range node.Children {
+		args = append(args, child)
+	}
+	ready, err := e.redisEngine.RunScript(ctx, completeScript, []string{e.key(id)}, args...)
+	if err != nil {
+		return fmt.Errorf("更新工作流 %s 失败: %w", id, err)
+	}
+
+	for _, value := range ready.([]interface{}) {
+		if err := e.enqueueReady(ctx, id, graph[value.(string)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resume 把运行中的工作流里所有父节点都已完成但还没有入队的节点入队，返回入队的节点数
+// 用于提交或推进工作流时入队失败后的恢复
+func (e *Engine) Resume(ctx context.Context, id string) (int, error) {
+	graph, err := e.loadGraph(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if graph == nil {
+		return 0, fmt.Errorf("工作流 %s 不存在", id)
+	}
+	values, err := e.redisEngine.HGetAll(ctx, e.key(id))
+	if err != nil {
+		return 0, fmt.Errorf("读取工作流失败: %w", err)
+	}
+	if values["state"] != string(StateRunning) {
+		return 0, nil
+	}
+
+	// 按节点名排序，保证每次恢复的顺序一致
+	names := make([]string, 0, len(graph))
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enqueued := 0
+	for _, name := range names {
+		if values["status:"+name] != NodePending || values["pending:"+name] != "0" {
+			continue
+		}
+		if err := e.enqueueReady(ctx, id, graph[name]); err != nil {
+			return enqueued, err
+		}
+		enqueued++
+	}
+	return enqueued, nil
+}
+
+// enqueueReady 读取父节点结果后把节点入队
+func (e *Engine) enqueueReady(ctx context.Context, id string, node *Node) error {
+	parentResults, err := e.parentResults(ctx, id, node)
+	if err != nil {
+		return err
+	}
+	return e.enqueue(ctx, id, node, parentResults)
+}
+
+func (e *Engine) parentResults(ctx context.Context, id string, node *Node) (map[string]interface{}, error) {
+	if len(node.Parents) == 0 {
+		return nil, nil
+	}
+	fields := make([]string, len(node.Parents))
+	for i, parent := range node.Parents {
+		fields[i] = "result:" + parent
+	}
+	values, err := e.redisEngine.HMGet(ctx, e.key(id), fields...)
+	if err != nil {
+		return nil, fmt.Errorf("读取父节点结果失败: %w", err)
+	}
+
+	results := make(map[string]interface{}, len(node.Parents))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var result interface{}
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("反序列化父节点结果失败: %w", err)
+		}
+		results[node.Parents[i]] = result
+	}
+	return results, nil
+}
+
+// TaskDead 节点进入死信队列，工作流失败
+func (e *Engine) TaskDead(ctx context.Context, task *taskstruct.Task) error {
+	id, name := task.Metadata[MetadataWorkflowID], task.Metadata[MetadataNode]
+	if id == "" {
+		return nil
+	}
+	message := ""
+	if len(task.Errors) > 0 {
+		message = task.Errors[len(task.Errors)-1].Message
+	}
+	failed, err := e.redisEngine.RunScript(ctx, failScript, []string{e.key(id)}, name, message, e.retention.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("更新工作流 %s 失败: %w", id, err)
+	}
+	if failed.(int64) == 1 {
+		e.logger.Warn("workflow failed", "workflow_id", id, "node", name, "task_id", task.ID)
+	}
+	return nil
+}
+
+// Status 返回工作流状态，工作流不存在或已过期时返回错误
+func (e *Engine) Status(ctx context.Context, id string) (*Status, error) {
+	values, err := e.redisEngine.HGetAll(ctx, e.key(id))
+	if err != nil {
+		return nil, fmt.Errorf("读取工作流失败: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("工作流 %s 不存在", id)
+	}
+
+	created, _ := strconv.ParseInt(values["created"], 10, 64)
+	status := &Status{
+		ID:      id,
+		State:   State(values["state"]),
+		Created: time.UnixMilli(created),
+		Error:   values["error"],
+		Nodes:   make(map[string]string),
+		Results: make(map[string]map[string]interface{}),
+	}
+	for field, value := range values {
+		if name, ok := strings.CutPrefix(field, "status:"); ok {
+			status.Nodes[name] = value
+		}
+		if name, ok := strings.CutPrefix(field, "result:"); ok {
+			result := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(value), &result); err == nil {
+				status.Results[name] = result
+			}
+		}
+	}
+	return status, nil
+}
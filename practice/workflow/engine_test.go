@@ -0,0 +1,184 @@
+package workflow
+
+import (
+	"context"
+	"testing"
+
+	"practice/internal/testredis"
+	"practice/queue"
+	"practice/taskstruct"
+)
+
+// complete 取出一个任务并作为成功处理
+func complete(t *testing.T, e *Engine, q *queue.Queue, result map[string]interface{}) *taskstruct.Task {
+	t.Helper()
+	task, err := q.DequeueTask(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Result = result
+	if err := e.TaskCompleted(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestDiamondWorkflow(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	e := NewEngine(engine)
+	q := queue.NewQueue("jobs", engine)
+
+	w := New()
+	w.Add("fetch", "jobs", taskstruct.NewTask("fetch", nil, 3))
+	w.Add("resize", "jobs", taskstruct.NewTask("resize", nil, 3), "fetch")
+	w.Add("scan", "jobs", taskstruct.NewTask("scan", nil, 3), "fetch")
+	w.Add("publish", "jobs", taskstruct.NewTask("publish", nil, 3), "resize", "scan")
+
+	id, err := e.Submit(ctx, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task := complete(t, e, q, map[string]interface{}{"url": "a"}); task.Type != "fetch" {
+		t.Fatalf("first task = %s, want fetch", task.Type)
+	}
+	complete(t, e, q, map[string]interface{}{"ok": true})
+	// publish 要等 resize 和 scan 都完成
+	if pending, _ := engine.LLen(ctx, q.GetQueueKey()); pending != 1 {
+		t.Fatalf("pending = %d, want only the other parent", pending)
+	}
+	complete(t, e, q, map[string]interface{}{"ok": true})
+
+	publish := complete(t, e, q, nil)
+	if publish.Type != "publish" || len(ParentResults(publish)) != 2 {
+		t.Fatalf("publish = %+v, want results of both parents", publish)
+	}
+	status, err := e.Status(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateCompleted || status.Results["fetch"]["url"] != "a" {
+		t.Fatalf("status = %+v, want completed with fetch result", status)
+	}
+}
+
+func TestSubmitTwiceUsesNewTaskIDs(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	e := NewEngine(engine)
+	template := taskstruct.NewTask("fetch", nil, 3)
+	w := Chain("jobs", template)
+
+	if _, err := e.Submit(ctx, w); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Submit(ctx, w); err != nil {
+		t.Fatalf("second Submit error = %v, want nil", err)
+	}
+	if pending, _ := engine.LLen(ctx, queue.QueueKey(queue.KindQueue, "jobs")); pending != 2 {
+		t.Fatalf("pending = %d, want 2", pending)
+	}
+	if template.Metadata != nil {
+		t.Fatalf("template metadata = %v, want the template left unchanged", template.Metadata)
+	}
+}
+
+func TestCompletedRetryEnqueuesChildren(t *testing.T) {
+	ctx := context.Background()
+	mr, engine := testredis.New(t)
+	e := NewEngine(engine)
+	q := queue.NewQueue("jobs", engine)
+
+	id, err := e.Submit(ctx, Chain("jobs", taskstruct.NewTask("fetch", nil, 3), taskstruct.NewTask("store", nil, 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := q.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 子节点入队失败: 队列注册集合类型错误使入队脚本报错
+	mr.Del(engine.GetQueuesKey())
+	if err := mr.Set(engine.GetQueuesKey(), "broken"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.TaskCompleted(ctx, task); err == nil {
+		t.Fatal("TaskCompleted error = nil, want enqueue failure")
+	}
+	mr.Del(engine.GetQueuesKey())
+
+	// 再次调用时节点已完成，只补上没有入队的子节点
+	if err := e.TaskCompleted(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	child, err := q.DequeueTask(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child.Type != "store" || ParentResults(child) == nil {
+		t.Fatalf("child = %+v, want store with parent results", child)
+	}
+	if err := e.TaskCompleted(ctx, child); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := e.Status(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != StateCompleted {
+		t.Fatalf("state = %s, want completed", status.State)
+	}
+}
+
+func TestResumeEnqueuesReadyNodes(t *testing.T) {
+	ctx := context.Background()
+	mr, engine := testredis.New(t)
+	e := NewEngine(engine)
+
+	if err := mr.Set(engine.GetQueuesKey(), "broken"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := e.Submit(ctx, Chain("jobs", taskstruct.NewTask("fetch", nil, 3), taskstruct.NewTask("store", nil, 3)))
+	if err == nil {
+		t.Fatal("Submit error = nil, want enqueue failure")
+	}
+	mr.Del(engine.GetQueuesKey())
+
+	enqueued, err := e.Resume(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enqueued != 1 {
+		t.Fatalf("enqueued = %d, want only the root", enqueued)
+	}
+	status, err := e.Status(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Nodes["step-0"] != NodeEnqueued || status.Nodes["step-1"] != NodePending {
+		t.Fatalf("nodes = %v, want root enqueued and child pending", status.Nodes)
+	}
+}
+
+// 任务为 nil 的节点在添加时报错，Submit 返回同一个错误而不是在生成任务时 panic
+func TestSubmitRejectsNilTask(t *testing.T) {
+	ctx := context.Background()
+	_, engine := testredis.New(t)
+	e := NewEngine(engine)
+
+	w := New()
+	if err := w.Add("fetch", "jobs", nil); err == nil {
+		t.Fatal("Add(nil task) error = nil, want error")
+	}
+	if _, err := e.Submit(ctx, w); err == nil {
+		t.Fatal("Submit error = nil, want the Add error")
+	}
+	if _, err := e.Submit(ctx, Chain("jobs", taskstruct.NewTask("fetch", nil, 3), nil)); err == nil {
+		t.Fatal("Submit(Chain with nil task) error = nil, want error")
+	}
+	if size, _ := engine.LLen(ctx, queue.QueueKey(queue.KindQueue, "jobs")); size != 0 {
+		t.Fatalf("queue size = %d, want nothing enqueued", size)
+	}
+}
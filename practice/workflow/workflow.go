@@ -0,0 +1,105 @@
+// 任务工作流
+
+// 工作流是由任务模板组成的有向无环图，保存在 Redis 中
+// 根任务在提交时入队，其余任务在所有父任务成功后入队，父任务的结果随负载传给子任务
+// 任一任务进入死信队列时工作流失败，尚未入队的后续任务不再执行
+
+package workflow
+
+import (
+	"fmt"
+	"practice/taskstruct"
+)
+
+// 工作流写入任务元数据的key，用于在任务完成时找到所属的工作流和节点
+const (
+	MetadataWorkflowID = "workflow_id"
+	MetadataNode       = "workflow_node"
+)
+
+// ParentResultsKey 子任务负载中保存父任务结果的字段，值为 节点名->结果
+const ParentResultsKey = "parent_results"
+
+// Node 工作流中的一个任务
+type Node struct {
+	Name     string           `json:"name"`
+	Queue    string           `json:"queue"` // 任务入队的队列名称
+	Task     *taskstruct.Task `json:"task"`  // 任务模板
+	Parents  []string         `json:"parents,omitempty"`
+	Children []string         `json:"children,omitempty"`
+}
+
+type Workflow struct {
+	nodes []*Node
+	index map[string]*Node
+	err   error // 第一次添加节点失败的错误，Submit 时返回
+}
+
+func New() *Workflow {
+	return &Workflow{index: make(map[string]*Node)}
+}
+
+// Chain 依次执行的工作流，节点名称为 step-0、step-1 ...
+// 任务为 nil 等添加失败的错误在 Engine.Submit 时返回
+func Chain(queueName string, tasks ...*taskstruct.Task) *Workflow {
+	w := New()
+	parent := ""
+	for i, task := range tasks {
+		name := fmt.Sprintf("step-%d", i)
+		if parent == "" {
+			w.Add(name, queueName, task)
+		} else {
+			w.Add(name, queueName, task, parent)
+		}
+		parent = name
+	}
+	return w
+}
+
+// Add 添加节点，父节点必须已经添加，因此图中不会出现环
+// 添加失败时工作流记录第一个错误，Engine.Submit 会拒绝提交
+func (w *Workflow) Add(name, queueName string, task *taskstruct.Task, parents ...string) error {
+	if err := w.validate(name, task, parents); err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return err
+	}
+
+	node := &Node{Name: name, Queue: queueName, Task: task, Parents: parents}
+	for _, parent := range parents {
+		w.index[parent].Children = append(w.index[parent].Children, name)
+	}
+	w.nodes = append(w.nodes, node)
+	w.index[name] = node
+	return nil
+}
+
+func (w *Workflow) validate(name string, task *taskstruct.Task, parents []string) error {
+	if name == "" {
+		return fmt.Errorf("节点名称不能为空")
+	}
+	if task == nil {
+		return fmt.Errorf("节点 %s 的任务不能为空", name)
+	}
+	if _, ok := w.index[name]; ok {
+		return fmt.Errorf("节点 %s 已存在", name)
+	}
+	for _, parent := range parents {
+		if _, ok := w.index[parent]; !ok {
+			return fmt.Errorf("节点 %s 的父节点 %s 不存在", name, parent)
+		}
+	}
+	return nil
+}
+
+// Nodes 按添加顺序返回所有节点
+func (w *Workflow) Nodes() []*Node {
+	return w.nodes
+}
+
+// ParentResults 返回工作流传给子任务的父任务结果
+func ParentResults(task *taskstruct.Task) map[string]interface{} {
+	results, _ := task.Payload[ParentResultsKey].(map[string]interface{})
+	return results
+}